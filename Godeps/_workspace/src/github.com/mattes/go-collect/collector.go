@@ -30,8 +30,17 @@ type Collector struct {
 	sources []string
 
 	defaultSource string
+
+	// layers are loaded after sources, see AddLayer
+	layers []string
+
+	// origins are the sources of all keys, see Origin
+	origins map[string]string
 }
 
+// FlagsOrigin is the origin of data given by args
+const FlagsOrigin = "flags"
+
 func New() *Collector {
 	return &Collector{
 		args:          make([]string, 0),
@@ -39,6 +48,8 @@ func New() *Collector {
 		label:         "",
 		sources:       make([]string, 0),
 		defaultSource: "",
+		layers:        make([]string, 0),
+		origins:       make(map[string]string),
 	}
 }
 
@@ -89,10 +100,16 @@ func (c *Collector) Parse(args []string, f ...*flags.Flags) (p *data.Data, remai
 
 		// merge data from Load
 		sourceData.Merge(p)
+		for _, k := range p.Keys() {
+			c.origins[k] = sarg
+		}
 	}
 
 	// overwrite with args data
 	sourceData.Merge(argsData)
+	for _, k := range argsData.Keys() {
+		c.origins[k] = FlagsOrigin
+	}
 
 	if isLabel {
 		c.label = tmpLabel
@@ -132,6 +149,32 @@ func (c *Collector) Labels() []string {
 	return rl
 }
 
+// Groups returns the label groups of all sources
+func (c *Collector) Groups() map[string][]string {
+	return c.grouperMap(Grouper.Groups)
+}
+
+// Dependencies returns the labels every label depends on of all sources
+func (c *Collector) Dependencies() map[string][]string {
+	return c.grouperMap(Grouper.Dependencies)
+}
+
+func (c *Collector) grouperMap(get func(Grouper) map[string][]string) map[string][]string {
+	m := make(map[string][]string)
+	for _, sarg := range c.Sources() {
+		s, err := c.getSourceFromScheme(sarg)
+		if err != nil {
+			continue
+		}
+		if g, ok := s.(Grouper); ok {
+			for k, v := range get(g) {
+				m[k] = append(m[k], v...)
+			}
+		}
+	}
+	return m
+}
+
 func (c *Collector) AddFlags(f ...*flags.Flags) {
 	for _, ff := range f {
 		if ff != nil {
@@ -161,12 +204,24 @@ func (c *Collector) Label() string {
 	return c.label
 }
 
+// AddLayer adds sources that are always loaded, after the sources
+// given by args or the default source, but before args data
+func (c *Collector) AddLayer(s ...string) {
+	c.layers = append(c.layers, s...)
+}
+
+// Origin returns the source the value of key came from,
+// FlagsOrigin for args or an empty string if key is unknown
+func (c *Collector) Origin(key string) string {
+	return c.origins[key]
+}
+
 func (c *Collector) Sources() []string {
+	sources := c.sources
 	if len(c.sources) == 0 && c.defaultSource != "" {
-		return []string{c.defaultSource}
-	} else {
-		return c.sources
+		sources = []string{c.defaultSource}
 	}
+	return append(append([]string{}, sources...), c.layers...)
 }
 
 func (c *Collector) SetDefaultSource(s string) {
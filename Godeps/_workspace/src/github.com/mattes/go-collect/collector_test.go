@@ -197,6 +197,28 @@ func TestSources(t *testing.T) {
 
 	c.AddSource("another://")
 	assert.Equal(t, []string{"another://"}, c.Sources())
+
+	c.AddLayer("layer://")
+	assert.Equal(t, []string{"another://", "layer://"}, c.Sources())
+}
+
+func TestOrigin(t *testing.T) {
+	f := flags.New("")
+	f.String([]string{"-foo"}, "", "")
+
+	RegisterSource(&urlquery.UrlQuery{})
+	c := New()
+	c.SetDefaultSource("urlquery://foo=a&bar=a&baz=a")
+	c.AddLayer("urlquery://bar=b")
+
+	d, _, err := c.Parse([]string{"--foo=c"}, f)
+	assert.NoError(t, err)
+	assert.Equal(t, "c", d.Get("foo"))
+	assert.Equal(t, "b", d.Get("bar"))
+	assert.Equal(t, FlagsOrigin, c.Origin("foo"))
+	assert.Equal(t, "urlquery://bar=b", c.Origin("bar"))
+	assert.Equal(t, "urlquery://foo=a&bar=a&baz=a", c.Origin("baz"))
+	assert.Equal(t, "", c.Origin("bogus"))
 }
 
 func TestUpperFirst(t *testing.T) {
@@ -172,3 +172,14 @@ func TestIsTrue(t *testing.T) {
 func TestIsFalse(t *testing.T) {
 	// TODO
 }
+
+func TestIndexed(t *testing.T) {
+	v := make(Indexed)
+	v.Add("publish", 10, "c")
+	v.Add("publish", 2, "b")
+	v.Add("publish", 0, "a")
+	v.Add("image", PlainIndex, "redis")
+	d := v.Data()
+	assert.Equal(t, []string{"a", "b", "c"}, d.GetAll("publish"))
+	assert.Equal(t, "redis", d.Get("image"))
+}
@@ -0,0 +1,39 @@
+package data
+
+import (
+	"sort"
+)
+
+// Indexed collects list items stored one per key, i.e. publish_0 and
+// publish_1, and returns them as lists sorted by index
+type Indexed map[string]map[int]string
+
+// PlainIndex is the index of a value that is no list item
+const PlainIndex = -1
+
+// Add sets the value of name at index, see PlainIndex
+func (v Indexed) Add(name string, index int, value string) {
+	if v[name] == nil {
+		v[name] = make(map[int]string)
+	}
+	v[name][index] = value
+}
+
+// Data returns the values of every name sorted by index
+func (v Indexed) Data() *Data {
+	d := New()
+	for name, byIndex := range v {
+		indexes := make([]int, 0, len(byIndex))
+		for i := range byIndex {
+			indexes = append(indexes, i)
+		}
+		sort.Ints(indexes)
+
+		list := make([]string, 0, len(indexes))
+		for _, i := range indexes {
+			list = append(list, byIndex[i])
+		}
+		d.Set(name, list...)
+	}
+	return d
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/docker/docker/pkg/mflag"
 	"github.com/docker/docker/utils"
 	"github.com/mattes/go-collect/data"
+	"io"
 	"strings"
 )
 
@@ -14,6 +15,14 @@ type Flags struct {
 	flagset *mflag.FlagSet
 }
 
+// Flag describes a defined flag
+type Flag struct {
+	// Names are like in mflag, i.e. -e, -env
+	Names    []string
+	Usage    string
+	DefValue string
+}
+
 func New(name string) *Flags {
 	d := &Flags{}
 	d.Name = name
@@ -94,6 +103,31 @@ func (d *Flags) PrintUsage() {
 	d.flagset.PrintDefaults()
 }
 
+// WriteUsage writes the usage of PrintUsage to w
+func (d *Flags) WriteUsage(w io.Writer) {
+	out := d.flagset.Out()
+	d.flagset.SetOutput(w)
+	d.flagset.PrintDefaults()
+	d.flagset.SetOutput(out)
+}
+
+// All returns all defined flags sorted by name
+func (d *Flags) All() []Flag {
+	all := make([]Flag, 0)
+	d.flagset.VisitAll(func(m *mflag.Flag) {
+		names := make([]string, 0, len(m.Names))
+		for _, n := range m.Names {
+			if !strings.HasPrefix(n, "#") {
+				names = append(names, n)
+			}
+		}
+		if len(names) > 0 {
+			all = append(all, Flag{Names: names, Usage: m.Usage, DefValue: m.DefValue})
+		}
+	})
+	return all
+}
+
 func (d *Flags) Exists(name string) bool {
 	if d.flagset.Lookup("-"+name) != nil {
 		return true
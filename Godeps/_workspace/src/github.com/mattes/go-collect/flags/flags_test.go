@@ -24,6 +24,17 @@ func TestKeys(t *testing.T) {
 	assert.Len(t, keys, 2)
 }
 
+func TestAll(t *testing.T) {
+	f := New("")
+	f.String([]string{"-foo"}, "x", "Foo usage")
+	f.Bool([]string{"b", "#bar", "-bar"}, false, "Bar usage")
+
+	assert.Equal(t, []Flag{
+		{Names: []string{"b", "-bar"}, Usage: "Bar usage", DefValue: "false"},
+		{Names: []string{"-foo"}, Usage: "Foo usage", DefValue: "x"},
+	}, f.All())
+}
+
 func TestParse(t *testing.T) {
 	// assume that github.com/docker/docker/pkg/mflag is tested
 
@@ -25,6 +25,16 @@ type Source interface {
 	Labels() []string
 }
 
+// Grouper is implemented by sources that know groups of labels
+// and dependencies between labels
+type Grouper interface {
+	// Returns the labels of every group
+	Groups() map[string][]string
+
+	// Returns the labels every label depends on
+	Dependencies() map[string][]string
+}
+
 var sources = make(map[string]Source)
 
 func RegisterSource(s Source) {
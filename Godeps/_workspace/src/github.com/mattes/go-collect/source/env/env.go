@@ -0,0 +1,88 @@
+package env
+
+import (
+	"github.com/mattes/go-collect/data"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultPrefix is used if the url has no prefix, i.e. env://
+const DefaultPrefix = "FUGU"
+
+// LabelSeparator separates label and key, i.e. FUGU_API__IMAGE
+const LabelSeparator = "__"
+
+// Env implements Source interface. FUGU_IMAGE sets image, FUGU_PUBLISH_0
+// and FUGU_PUBLISH_1 set the list publish and FUGU_API__NAME sets name
+// for label api only. Label specific vars overwrite the others.
+type Env struct {
+	// Environ returns the env vars, os.Environ if nil
+	Environ func() []string
+}
+
+func (s *Env) Scheme() string {
+	return "env"
+}
+
+func (s *Env) ExampleUrl() string {
+	return "env://" + DefaultPrefix
+}
+
+func (s *Env) Load(label string, u *url.URL) (*data.Data, error) {
+	prefix := strings.ToUpper(u.Host)
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	prefix += "_"
+
+	environ := os.Environ
+	if s.Environ != nil {
+		environ = s.Environ
+	}
+
+	all, labelOnly := make(data.Indexed), make(data.Indexed)
+	for _, e := range environ() {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) != 2 || !strings.HasPrefix(kv[0], prefix) {
+			continue
+		}
+		name := strings.TrimPrefix(kv[0], prefix)
+
+		if i := strings.Index(name, LabelSeparator); i >= 0 {
+			if label != "" && name[:i] == envName(label) {
+				add(labelOnly, name[i+len(LabelSeparator):], kv[1])
+			}
+			continue
+		}
+		add(all, name, kv[1])
+	}
+
+	d := all.Data()
+	d.Merge(labelOnly.Data())
+	return d, nil
+}
+
+func (s *Env) Labels() []string {
+	return nil
+}
+
+// envName returns the label as used in env var names, i.e. API_V2 for api-v2
+func envName(label string) string {
+	return strings.ToUpper(strings.Replace(label, "-", "_", -1))
+}
+
+// indexed matches names of list items, i.e. PUBLISH_0
+var indexed = regexp.MustCompile(`^(.+)_([0-9]+)$`)
+
+// add adds the value of the env var name, i.e. PUBLISH_0 as item 0 of publish
+func add(v data.Indexed, name, value string) {
+	index := data.PlainIndex
+	if m := indexed.FindStringSubmatch(name); m != nil {
+		name = m[1]
+		index, _ = strconv.Atoi(m[2])
+	}
+	v.Add(strings.ToLower(strings.Replace(name, "_", "-", -1)), index, value)
+}
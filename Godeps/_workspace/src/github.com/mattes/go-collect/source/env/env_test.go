@@ -0,0 +1,67 @@
+package env
+
+import (
+	"github.com/mattes/go-collect/data"
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	s := &Env{Environ: func() []string {
+		return []string{
+			"FUGU_IMAGE=redis",
+			"FUGU_LOG_DRIVER=syslog",
+			"FUGU_PUBLISH_1=443",
+			"FUGU_PUBLISH_0=80",
+			"FUGU_API_V2__NAME=my-api",
+			"FUGU_API_V2__IMAGE=api",
+			"FUGU_OTHER__NAME=other",
+			"MYAPP_IMAGE=myapp",
+			"HOME=/root",
+		}
+	}}
+
+	var tests = []struct {
+		testDesc string
+		label    string
+		url      string
+		data     *data.Data
+	}{
+		{
+			testDesc: "without label",
+			label:    "",
+			url:      "env://",
+			data: data.ToData(map[string][]string{
+				"image":      []string{"redis"},
+				"log-driver": []string{"syslog"},
+				"publish":    []string{"80", "443"},
+			}),
+		},
+		{
+			testDesc: "label overwrites",
+			label:    "api-v2",
+			url:      "env://",
+			data: data.ToData(map[string][]string{
+				"image":      []string{"api"},
+				"name":       []string{"my-api"},
+				"log-driver": []string{"syslog"},
+				"publish":    []string{"80", "443"},
+			}),
+		},
+		{
+			testDesc: "prefix",
+			label:    "",
+			url:      "env://myapp",
+			data:     data.ToData(map[string][]string{"image": []string{"myapp"}}),
+		},
+	}
+
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		d, err := s.Load(tt.label, u)
+		assert.NoError(t, err, tt.testDesc)
+		assert.Equal(t, tt.data, d, tt.testDesc)
+	}
+	assert.Nil(t, s.Labels())
+}
@@ -2,8 +2,10 @@ package file
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/BurntSushi/toml"
 	"github.com/mattes/go-collect/data"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
@@ -11,12 +13,32 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 )
 
 var (
 	ErrEmptyPath   = errors.New("source: file: no path given")
 	ErrYamlParsing = errors.New("source: file: yaml parsing failed")
-	ErrYamlLevels  = errors.New("source: file: only 2 levels of indentation allowed")
+	ErrJsonParsing = errors.New("source: file: json parsing failed")
+	ErrTomlParsing = errors.New("source: file: toml parsing failed")
+	ErrUnknownDep  = errors.New("source: file: unknown label")
+	ErrDepCycle    = errors.New("source: file: depends-on cycle")
+	ErrGroups      = errors.New("source: file: groups must be a map of label lists")
+)
+
+const (
+	// groupsKey is the top level key listing labels by group name
+	groupsKey = "groups"
+
+	// dependsOnKey lists the labels a label depends on
+	dependsOnKey = "depends-on"
+
+	formatYaml = "yaml"
+	formatJson = "json"
+	formatToml = "toml"
+
+	// KeySeparator joins the keys of nested maps, i.e. tasks.migrate.command
+	KeySeparator = "."
 )
 
 // File implements Source interface
@@ -27,10 +49,13 @@ type File struct {
 
 	body []byte
 
-	// TODO implement json, toml, ...
+	// yaml is the parsed file, whatever its format
 	yaml map[string]map[string][]string
 
 	labels []string
+
+	groups    map[string][]string
+	dependsOn map[string][]string
 }
 
 func (s *File) Scheme() string {
@@ -48,6 +73,14 @@ func (s *File) Load(label string, u *url.URL) (*data.Data, error) {
 	if err := s.readFile(); err != nil {
 		return nil, err
 	}
+	return s.LoadBody(label, s.path, s.body)
+}
+
+// LoadBody parses body like a file at path and returns data for label.
+// Sources that fetch files from elsewhere use it, see source/http.
+func (s *File) LoadBody(label, path string, body []byte) (*data.Data, error) {
+	s.path = path
+	s.body = body
 	if err := s.parse(); err != nil {
 		return nil, err
 	}
@@ -64,6 +97,16 @@ func (s *File) Labels() []string {
 	return s.labels
 }
 
+// Groups returns the labels of every group
+func (s *File) Groups() map[string][]string {
+	return s.groups
+}
+
+// Dependencies returns the depends-on labels of every label
+func (s *File) Dependencies() map[string][]string {
+	return s.dependsOn
+}
+
 func (s *File) setPathFromUrl() {
 	// TODO what about windows and file://paths?
 
@@ -91,64 +134,54 @@ func (s *File) readFile() error {
 	return nil
 }
 
-// parse parses the file content into a yaml struct
+// parse parses the file content, see decode
 func (s *File) parse() error {
 
 	// inject env vars
 	s.body = injectEnvVars(s.body)
 
-	// Parse '<<:' to '<:' so we don't trigger the internal
-	// yaml pkg inheritance parsing. it will fail because of
-	// `map[string]map[string]interface{}`.
-	// yaml: map merge requires map or sequence of maps as the value
-	// We also don't want to rely on *label markers for inheritance.
-
-	// this major wtf replaces <<: with <: in every line
-	reRepl := regexp.MustCompile("^\\s*(<<:)")
-	spl := bytes.Split(s.body, []byte("\n"))
-	for i := 0; i < len(spl); i++ {
-		spl[i] = reRepl.ReplaceAllFunc(spl[i], func(in []byte) []byte {
-			// whitespace to replacement in order to allow <<:label, instead of <<: label
-			return bytes.Replace(in, []byte("<<:"), []byte("<: "), 1)
-		})
+	raw, order, err := s.decode()
+	if err != nil {
+		return err
 	}
-	s.body = bytes.Join(spl, []byte("\n"))
 
-	// try to unmarshal with labels
+	// the file has labels if all top level values are maps
 	hasLabels := true
-	var yamlWithLabels map[string]map[string]interface{}
-	if err := yaml.Unmarshal(s.body, &yamlWithLabels); err != nil {
-		// try without labels
-		var yamlNoLabels map[string]interface{}
-		if err := yaml.Unmarshal(s.body, &yamlNoLabels); err != nil {
-			return ErrYamlParsing
+	for _, v := range raw {
+		if v != nil && toStringMap(v) == nil {
+			hasLabels = false
+			break
 		}
+	}
 
-		yamlWithLabels = map[string]map[string]interface{}{
-			"default": yamlNoLabels,
-		}
-		hasLabels = false
+	// groups is reserved, it lists labels by group name
+	if v, ok := raw[groupsKey]; ok && (!hasLabels || !isGroups(v)) {
+		return ErrGroups
+	}
+
+	if !hasLabels {
+		raw = map[string]interface{}{"default": raw}
 	}
 
-	// map[string]map[string]interface{} -> map[string]map[string][]string
+	// map[string]interface{} -> map[string]map[string][]string
 	s.yaml = make(map[string]map[string][]string)
-	for k, v := range yamlWithLabels {
+	for k, v := range raw {
 		s.yaml[k] = make(map[string][]string)
-		for k2, v2 := range v {
-			s.yaml[k][k2] = make([]string, 0)
-			switch v2.(type) {
-			case []interface{}:
-				s.yaml[k][k2] = interfaceSliceToStringSlice(v2.([]interface{}))
-
-			case map[interface{}]interface{}:
-				return ErrYamlLevels
-
-			default:
-				s.yaml[k][k2] = []string{fmt.Sprintf("%v", v2)}
+		for k2, v2 := range toStringMap(v) {
+			// json and toml have no <<: parsing issues, use the same key
+			if k2 == "<<" {
+				k2 = "<"
 			}
+			flatten(k2, v2, s.yaml[k])
 		}
 	}
 
+	s.groups = make(map[string][]string)
+	if groups, ok := s.yaml[groupsKey]; ok {
+		s.groups = groups
+		delete(s.yaml, groupsKey)
+	}
+
 	// parse inheritance, do this until all referenced labels are referenced
 	allParsed := false
 	for !allParsed {
@@ -186,18 +219,222 @@ func (s *File) parse() error {
 
 	// get labels and their order
 	if hasLabels {
-		var labelOrder yaml.MapSlice
-		if err := yaml.Unmarshal(s.body, &labelOrder); err != nil {
-			return ErrYamlParsing
-		}
 		s.labels = make([]string, 0)
-		for _, v := range labelOrder {
-			s.labels = append(s.labels, v.Key.(string))
+		for _, k := range order {
+			if k != groupsKey {
+				s.labels = append(s.labels, k)
+			}
 		}
 	} else {
 		s.labels = []string{"default"}
 	}
 
+	return s.parseDependencies()
+}
+
+// decode decodes the file as yaml, json or toml, see format. It
+// returns the top level keys in the order found in the file.
+func (s *File) decode() (raw map[string]interface{}, order []string, err error) {
+	switch s.format() {
+	case formatJson:
+		return decodeJson(s.body)
+	case formatToml:
+		return decodeToml(s.body)
+	default:
+		return decodeYaml(s.body)
+	}
+}
+
+// format returns the format by file extension or by content
+func (s *File) format() string {
+	switch strings.ToLower(filepath.Ext(s.path)) {
+	case ".json":
+		return formatJson
+	case ".toml":
+		return formatToml
+	case ".yml", ".yaml":
+		return formatYaml
+	}
+
+	for _, line := range strings.Split(string(s.body), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "{") {
+			return formatJson
+		}
+		if tomlLine.MatchString(line) {
+			return formatToml
+		}
+		break
+	}
+	return formatYaml
+}
+
+// tomlLine matches a toml table or key = value, but no yaml
+var tomlLine = regexp.MustCompile(`^(\[[^\]]+\]$|[^:]+=)`)
+
+func decodeYaml(body []byte) (map[string]interface{}, []string, error) {
+	// Parse '<<:' to '<:' so we don't trigger the internal
+	// yaml pkg inheritance parsing. it will fail because of
+	// `map[string]map[string]interface{}`.
+	// yaml: map merge requires map or sequence of maps as the value
+	// We also don't want to rely on *label markers for inheritance.
+
+	// this major wtf replaces <<: with <: in every line
+	reRepl := regexp.MustCompile("^\\s*(<<:)")
+	spl := bytes.Split(body, []byte("\n"))
+	for i := 0; i < len(spl); i++ {
+		spl[i] = reRepl.ReplaceAllFunc(spl[i], func(in []byte) []byte {
+			// whitespace to replacement in order to allow <<:label, instead of <<: label
+			return bytes.Replace(in, []byte("<<:"), []byte("<: "), 1)
+		})
+	}
+	body = bytes.Join(spl, []byte("\n"))
+
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(body, &raw); err != nil {
+		return nil, nil, ErrYamlParsing
+	}
+
+	var keys yaml.MapSlice
+	if err := yaml.Unmarshal(body, &keys); err != nil {
+		return nil, nil, ErrYamlParsing
+	}
+	order := make([]string, 0, len(keys))
+	for _, k := range keys {
+		order = append(order, fmt.Sprintf("%v", k.Key))
+	}
+	return raw, order, nil
+}
+
+func decodeJson(body []byte) (map[string]interface{}, []string, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, nil, fmt.Errorf("%v: %v", ErrJsonParsing.Error(), err.Error())
+	}
+
+	// JSON is YAML, too, so MapSlice keeps the key order
+	var keys yaml.MapSlice
+	if err := yaml.Unmarshal(body, &keys); err != nil {
+		return nil, nil, ErrJsonParsing
+	}
+	order := make([]string, 0, len(keys))
+	for _, k := range keys {
+		order = append(order, fmt.Sprintf("%v", k.Key))
+	}
+	return raw, order, nil
+}
+
+func decodeToml(body []byte) (map[string]interface{}, []string, error) {
+	var raw map[string]interface{}
+	md, err := toml.Decode(string(body), &raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%v: %v", ErrTomlParsing.Error(), err.Error())
+	}
+
+	order := make([]string, 0, len(raw))
+	for _, k := range md.Keys() {
+		if len(k) == 1 {
+			order = append(order, k[0])
+		}
+	}
+	return raw, order, nil
+}
+
+// toStringMap returns yaml, json and toml maps as map[string]interface{}
+// and nil for anything else
+func toStringMap(v interface{}) map[string]interface{} {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m
+
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(m))
+		for k, v2 := range m {
+			out[fmt.Sprintf("%v", k)] = v2
+		}
+		return out
+	}
+	return nil
+}
+
+// isGroups returns true if v maps group names to label lists
+func isGroups(v interface{}) bool {
+	groups := toStringMap(v)
+	if groups == nil {
+		return false
+	}
+	for _, labels := range groups {
+		list, ok := labels.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, l := range list {
+			if l == nil || toStringMap(l) != nil {
+				return false
+			}
+			if _, ok := l.([]interface{}); ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// parseDependencies reads depends-on of all labels. It fails for
+// unknown labels in groups and depends-on and for cycles.
+func (s *File) parseDependencies() error {
+	s.dependsOn = make(map[string][]string)
+	for _, label := range s.labels {
+		deps := s.yaml[label][dependsOnKey]
+		for _, d := range deps {
+			if !s.labelExists(d) {
+				return fmt.Errorf("%v %v in %v of %v", ErrUnknownDep.Error(), d, dependsOnKey, label)
+			}
+		}
+		if len(deps) > 0 {
+			s.dependsOn[label] = deps
+		}
+	}
+
+	for group, labels := range s.groups {
+		if s.labelExists(group) {
+			return fmt.Errorf("source: file: group %v is a label, too", group)
+		}
+		for _, l := range labels {
+			if !s.labelExists(l) {
+				return fmt.Errorf("%v %v in group %v", ErrUnknownDep.Error(), l, group)
+			}
+		}
+	}
+
+	// depth first search, path are the labels currently visited
+	done := make(map[string]bool)
+	var visit func(label string, path []string) error
+	visit = func(label string, path []string) error {
+		for i, l := range path {
+			if l == label {
+				return fmt.Errorf("%v: %v", ErrDepCycle.Error(), strings.Join(append(path[i:], label), " -> "))
+			}
+		}
+		if done[label] {
+			return nil
+		}
+		for _, d := range s.dependsOn[label] {
+			if err := visit(d, append(path, label)); err != nil {
+				return err
+			}
+		}
+		done[label] = true
+		return nil
+	}
+	for _, l := range s.labels {
+		if err := visit(l, nil); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -260,6 +497,23 @@ func (s *File) getData() *data.Data {
 	return d
 }
 
+// flatten sets key to value in out. Nested maps are flattened
+// to keys joined by KeySeparator, i.e. tasks.migrate.command
+func flatten(key string, value interface{}, out map[string][]string) {
+	switch v := value.(type) {
+	case []interface{}:
+		out[key] = interfaceSliceToStringSlice(v)
+
+	case map[string]interface{}, map[interface{}]interface{}:
+		for k, v2 := range toStringMap(v) {
+			flatten(key+KeySeparator+k, v2, out)
+		}
+
+	default:
+		out[key] = []string{fmt.Sprintf("%v", v)}
+	}
+}
+
 // interfaceSliceToStringSlice converts:
 // []interface{} -> []string
 func interfaceSliceToStringSlice(in []interface{}) []string {
@@ -114,19 +114,26 @@ func TestParse(t *testing.T) {
 		},
 
 		{
-			testDesc: "only support two levels of indentation",
+			testDesc: "flatten nested maps",
 			body: `
       label:
         image: test
-        name: foobar
-        fails:
-          foo: # ok
-            - bar # not ok
+        tasks:
+          migrate:
+            command: rake
+            args:
+              - db:migrate
+          flush: redis-cli flushall
       `,
-			label:  "",
-			data:   data.ToData(map[string][]string{}),
-			labels: nil,
-			err:    ErrYamlLevels,
+			label: "label",
+			data: data.ToData(map[string][]string{
+				"image":                 []string{"test"},
+				"tasks.migrate.command": []string{"rake"},
+				"tasks.migrate.args":    []string{"db:migrate"},
+				"tasks.flush":           []string{"redis-cli flushall"},
+			}),
+			labels: []string{"label"},
+			err:    nil,
 		},
 
 		{
@@ -232,6 +239,118 @@ func TestParse(t *testing.T) {
 	}
 }
 
+func TestParseFormats(t *testing.T) {
+	os.Setenv("SOME_RANDOM_GLOBAL_TEST_VAR_123", "foobar")
+
+	var tests = []struct {
+		testDesc string
+		path     string
+		body     string
+		label    string
+
+		data   *data.Data
+		labels []string
+		err    error
+	}{
+		{
+			testDesc: "json with labels and inheritance",
+			path:     "fugu.json",
+			body: `{
+        "label2": {"image": "image", "publish": [80, 443]},
+        "label1": {"<<": "label2", "name": "$SOME_RANDOM_GLOBAL_TEST_VAR_123", "tasks": {"flush": "redis-cli flushall"}}
+      }`,
+			label: "label1",
+			data: data.ToData(map[string][]string{
+				"image":       []string{"image"},
+				"publish":     []string{"80", "443"},
+				"name":        []string{"foobar"},
+				"tasks.flush": []string{"redis-cli flushall"},
+			}),
+			labels: []string{"label2", "label1"},
+		},
+
+		{
+			testDesc: "json detected by content, without labels",
+			body:     `{"image": "image", "detach": true}`,
+			label:    "default",
+			data: data.ToData(map[string][]string{
+				"image":  []string{"image"},
+				"detach": []string{"true"},
+			}),
+			labels: []string{"default"},
+		},
+
+		{
+			testDesc: "json indented with tabs",
+			path:     "fugu.json",
+			body:     "{\n\t\"web\": {\n\t\t\"image\": \"nginx\"\n\t},\n\t\"api\": {\"image\": \"redis\"}\n}",
+			label:    "api",
+			data:     data.ToData(map[string][]string{"image": []string{"redis"}}),
+			labels:   []string{"web", "api"},
+		},
+
+		{
+			testDesc: "toml with labels and inheritance",
+			path:     "fugu.toml",
+			body: `
+      [label2]
+      image = "image"
+      publish = [80, 443]
+
+      [label1]
+      "<<" = "label2"
+      name = "$SOME_RANDOM_GLOBAL_TEST_VAR_123"
+
+      [label1.tasks]
+      flush = "redis-cli flushall"
+      `,
+			label: "label1",
+			data: data.ToData(map[string][]string{
+				"image":       []string{"image"},
+				"publish":     []string{"80", "443"},
+				"name":        []string{"foobar"},
+				"tasks.flush": []string{"redis-cli flushall"},
+			}),
+			labels: []string{"label2", "label1"},
+		},
+
+		{
+			testDesc: "toml detected by content, without labels",
+			body: `
+      # comment
+      image = "image"
+      `,
+			label:  "default",
+			data:   data.ToData(map[string][]string{"image": []string{"image"}}),
+			labels: []string{"default"},
+		},
+
+		{
+			testDesc: "invalid json",
+			path:     "fugu.json",
+			body:     `{"label": }`,
+			err:      ErrJsonParsing,
+		},
+	}
+
+	for _, tt := range tests {
+		f := File{path: tt.path}
+		f.body = []byte(tt.body)
+		f.label = tt.label
+		err := f.parse()
+		if tt.err != nil {
+			if assert.Error(t, err, tt.testDesc) {
+				assert.Contains(t, err.Error(), tt.err.Error(), tt.testDesc)
+			}
+			continue
+		}
+		if assert.NoError(t, err, tt.testDesc) {
+			assert.Equal(t, tt.data, f.getData(), tt.testDesc)
+			assert.Equal(t, tt.labels, f.labels, tt.testDesc)
+		}
+	}
+}
+
 func TestSetPathFromUrl(t *testing.T) {
 	// TODO
 }
@@ -249,6 +368,82 @@ func TestLabels(t *testing.T) {
 	assert.Equal(t, 2, len(f.Labels()))
 }
 
+func TestDependencies(t *testing.T) {
+	f := File{}
+	f.body = []byte(`
+  groups:
+    backend: [app, worker]
+  redis:
+    image: redis
+  app:
+    image: app
+    depends-on: [redis]
+  worker:
+    image: worker
+    depends-on:
+      - redis
+      - app`)
+	assert.NoError(t, f.parse())
+	assert.Equal(t, []string{"redis", "app", "worker"}, f.Labels())
+	assert.Equal(t, map[string][]string{"backend": []string{"app", "worker"}}, f.Groups())
+	assert.Equal(t, map[string][]string{
+		"app":    []string{"redis"},
+		"worker": []string{"redis", "app"},
+	}, f.Dependencies())
+
+	var errTests = []struct {
+		body string
+		err  string
+	}{
+		{`
+  a:
+    depends-on: [b]
+  b:
+    depends-on: [c]
+  c:
+    depends-on: [a]`, "source: file: depends-on cycle: a -> b -> c -> a"},
+		{`
+  a:
+    depends-on: [a]`, "source: file: depends-on cycle: a -> a"},
+		{`
+  a:
+    depends-on: [b]`, "source: file: unknown label b in depends-on of a"},
+		{`
+  groups:
+    g: [a, b]
+  a:
+    image: a`, "source: file: unknown label b in group g"},
+		{`
+  groups: [a]
+  a:
+    image: a`, ErrGroups.Error()},
+		{`
+  groups:
+    g: a
+  a:
+    image: a`, ErrGroups.Error()},
+		{`
+  groups:
+    g:
+      a: b
+  a:
+    image: a`, ErrGroups.Error()},
+		{`
+  groups:
+    g: [a]
+  image: a`, ErrGroups.Error()},
+	}
+
+	for _, tt := range errTests {
+		f := File{}
+		f.body = []byte(tt.body)
+		err := f.parse()
+		if assert.Error(t, err, tt.body) {
+			assert.Equal(t, tt.err, err.Error())
+		}
+	}
+}
+
 func TestSelectLabel(t *testing.T) {
 	var tests = []struct {
 		labelsInFile []string
@@ -0,0 +1,257 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/mattes/go-collect/data"
+	"github.com/mattes/go-collect/source/file"
+	"io/ioutil"
+	"net"
+	nethttp "net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	ErrStatus = errors.New("source: http: unexpected status")
+)
+
+// Auth env vars, a token is used before user and password. They are
+// only sent over https and, if HostEnv is set, only to that host.
+const (
+	TokenEnv    = "COLLECT_HTTP_TOKEN"
+	UserEnv     = "COLLECT_HTTP_USER"
+	PasswordEnv = "COLLECT_HTTP_PASSWORD"
+	HostEnv     = "COLLECT_HTTP_HOST"
+)
+
+// DefaultTimeout is used if Client is nil
+const DefaultTimeout = 10 * time.Second
+
+// Http implements Source interface. It fetches a yaml, json or toml
+// document and parses it like the file source. User and password of
+// the url or the auth env vars are sent.
+type Http struct {
+	// Https selects the scheme https, otherwise http
+	Https bool
+
+	// CacheDir keeps the last fetched document of every url. It is
+	// revalidated with its ETag and used if the server is unreachable.
+	// Nothing is cached if empty.
+	CacheDir string
+
+	// Client is used for requests, a client with DefaultTimeout if nil
+	Client *nethttp.Client
+
+	// Warn is called when the cached copy is used, because the server
+	// is unreachable. It prints to stderr if nil.
+	Warn func(err error)
+
+	file file.File
+
+	// fetched are the documents fetched by this process
+	fetched map[string][]byte
+}
+
+func (s *Http) Scheme() string {
+	if s.Https {
+		return "https"
+	}
+	return "http"
+}
+
+func (s *Http) ExampleUrl() string {
+	return s.Scheme() + "://example.com/fugu.yml"
+}
+
+func (s *Http) Load(label string, u *url.URL) (*data.Data, error) {
+	body, err := s.get(u)
+	if err != nil {
+		return nil, err
+	}
+	return s.file.LoadBody(label, u.Path, body)
+}
+
+func (s *Http) Labels() []string {
+	return s.file.Labels()
+}
+
+// Groups returns the labels of every group
+func (s *Http) Groups() map[string][]string {
+	return s.file.Groups()
+}
+
+// Dependencies returns the depends-on labels of every label
+func (s *Http) Dependencies() map[string][]string {
+	return s.file.Dependencies()
+}
+
+// get returns the document at u, fetched once per process
+func (s *Http) get(u *url.URL) ([]byte, error) {
+	if s.fetched == nil {
+		s.fetched = make(map[string][]byte)
+	}
+	if body, ok := s.fetched[u.String()]; ok {
+		return body, nil
+	}
+
+	body, err := s.fetch(u)
+	if err != nil {
+		return nil, err
+	}
+	s.fetched[u.String()] = body
+	return body, nil
+}
+
+// fetch gets u, revalidating the cached copy. If the server is
+// unreachable or fails, it returns the cached copy.
+func (s *Http) fetch(u *url.URL) ([]byte, error) {
+	cached, etag := s.readCache(u)
+
+	body, newEtag, err := s.request(u, etag)
+	if err != nil {
+		if cached != nil && unreachable(err) {
+			s.warn(fmt.Errorf("%v, using cached copy", err.Error()))
+			return cached, nil
+		}
+		return nil, err
+	}
+
+	// not modified
+	if body == nil {
+		return cached, nil
+	}
+
+	s.writeCache(u, body, newEtag)
+	return body, nil
+}
+
+// statusError is returned for unexpected status codes
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%v %v", ErrStatus.Error(), e.status)
+}
+
+// unreachable is true for errors other than 4xx status codes
+func unreachable(err error) bool {
+	e, ok := err.(*statusError)
+	return !ok || e.code >= 500
+}
+
+// request gets u. It returns a nil body if etag is still valid.
+func (s *Http) request(u *url.URL, etag string) (body []byte, newEtag string, err error) {
+	// don't send user and password in the url
+	ru := *u
+	ru.User = nil
+
+	req, err := nethttp.NewRequest("GET", ru.String(), nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("source: http: %v", err.Error())
+	}
+
+	if u.User != nil {
+		password, _ := u.User.Password()
+		req.SetBasicAuth(u.User.Username(), password)
+	} else if envAuthAllowed(u) {
+		if token := os.Getenv(TokenEnv); token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		} else if user := os.Getenv(UserEnv); user != "" {
+			req.SetBasicAuth(user, os.Getenv(PasswordEnv))
+		}
+	}
+
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = &nethttp.Client{Timeout: DefaultTimeout}
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("source: http: %v", err.Error())
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == nethttp.StatusNotModified && etag != "":
+		return nil, etag, nil
+
+	case res.StatusCode != nethttp.StatusOK:
+		return nil, "", &statusError{code: res.StatusCode, status: res.Status}
+	}
+
+	body, err = ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("source: http: %v", err.Error())
+	}
+	return body, res.Header.Get("ETag"), nil
+}
+
+// envAuthAllowed is true if the auth env vars may be sent to u
+func envAuthAllowed(u *url.URL) bool {
+	if u.Scheme != "https" {
+		return false
+	}
+	host := os.Getenv(HostEnv)
+	if host == "" || host == u.Host {
+		return true
+	}
+	// COLLECT_HTTP_HOST without port matches any port
+	hostname, _, err := net.SplitHostPort(u.Host)
+	return err == nil && host == hostname
+}
+
+// cachePath returns the path of the cached copy of u, without
+// user and password, so they don't end up in file names
+func (s *Http) cachePath(u *url.URL) string {
+	cu := *u
+	cu.User = nil
+	sum := sha256.Sum256([]byte(cu.String()))
+	return filepath.Join(s.CacheDir, hex.EncodeToString(sum[:]))
+}
+
+// readCache returns the cached copy of u and its etag or nil
+func (s *Http) readCache(u *url.URL) (body []byte, etag string) {
+	if s.CacheDir == "" {
+		return nil, ""
+	}
+	body, err := ioutil.ReadFile(s.cachePath(u))
+	if err != nil {
+		return nil, ""
+	}
+	e, _ := ioutil.ReadFile(s.cachePath(u) + ".etag")
+	return body, string(e)
+}
+
+// writeCache keeps body and etag of u, errors are ignored,
+// the cache is an optimization only
+func (s *Http) writeCache(u *url.URL, body []byte, etag string) {
+	if s.CacheDir == "" {
+		return
+	}
+	if err := os.MkdirAll(s.CacheDir, 0700); err != nil {
+		return
+	}
+	if err := ioutil.WriteFile(s.cachePath(u), body, 0600); err != nil {
+		return
+	}
+	ioutil.WriteFile(s.cachePath(u)+".etag", []byte(etag), 0600)
+}
+
+func (s *Http) warn(err error) {
+	if s.Warn != nil {
+		s.Warn(err)
+		return
+	}
+	fmt.Fprintln(os.Stderr, err.Error())
+}
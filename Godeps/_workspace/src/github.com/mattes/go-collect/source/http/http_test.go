@@ -0,0 +1,184 @@
+package http
+
+import (
+	"crypto/tls"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+)
+
+const testBody = `
+label1:
+  image: redis
+  name: my-redis
+
+label2:
+  <<: label1
+  name: another-redis
+`
+
+// testServer serves testBody with an ETag and counts the requests
+type testServer struct {
+	*httptest.Server
+	requests []*nethttp.Request
+	status   int
+}
+
+func newTestServer() *testServer {
+	ts := &testServer{}
+	ts.Server = httptest.NewServer(ts)
+	return ts
+}
+
+func newTLSTestServer() *testServer {
+	ts := &testServer{}
+	ts.Server = httptest.NewTLSServer(ts)
+	return ts
+}
+
+func (ts *testServer) ServeHTTP(w nethttp.ResponseWriter, r *nethttp.Request) {
+	ts.requests = append(ts.requests, r)
+	if ts.status != 0 {
+		w.WriteHeader(ts.status)
+		return
+	}
+	if r.Header.Get("If-None-Match") == `"v1"` {
+		w.WriteHeader(nethttp.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", `"v1"`)
+	w.Write([]byte(testBody))
+}
+
+// url returns the url of path on the server
+func (ts *testServer) url(path string) *url.URL {
+	u, _ := url.Parse(ts.URL + path)
+	return u
+}
+
+func TestLoad(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+
+	s := &Http{}
+	d, err := s.Load("label2", ts.url("/fugu.yml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "redis", d.Get("image"))
+	assert.Equal(t, "another-redis", d.Get("name"))
+	assert.Equal(t, []string{"label1", "label2"}, s.Labels())
+
+	// fetched once per process
+	_, err = s.Load("label1", ts.url("/fugu.yml"))
+	assert.NoError(t, err)
+	assert.Len(t, ts.requests, 1)
+
+	ts.status = nethttp.StatusNotFound
+	_, err = s.Load("label1", ts.url("/missing.yml"))
+	assert.EqualError(t, err, "source: http: unexpected status 404 Not Found")
+}
+
+func TestAuth(t *testing.T) {
+	ts := newTLSTestServer()
+	defer ts.Close()
+	plain := newTestServer()
+	defer plain.Close()
+
+	// trusts the test certificate
+	s := func() *Http {
+		return &Http{Https: true, Client: &nethttp.Client{Transport: &nethttp.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}}
+	}
+
+	for _, k := range []string{TokenEnv, UserEnv, PasswordEnv, HostEnv} {
+		defer os.Setenv(k, os.Getenv(k))
+		os.Setenv(k, "")
+	}
+
+	os.Setenv(UserEnv, "env-user")
+	os.Setenv(PasswordEnv, "env-password")
+	_, err := s().Load("", ts.url(""))
+	assert.NoError(t, err)
+	user, password, ok := ts.requests[0].BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "env-user", user)
+	assert.Equal(t, "env-password", password)
+
+	os.Setenv(TokenEnv, "secret")
+	_, err = s().Load("", ts.url(""))
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer secret", ts.requests[1].Header.Get("Authorization"))
+
+	// only to the configured host
+	os.Setenv(HostEnv, "config.example.com")
+	_, err = s().Load("", ts.url(""))
+	assert.NoError(t, err)
+	assert.Empty(t, ts.requests[2].Header.Get("Authorization"))
+
+	os.Setenv(HostEnv, "127.0.0.1")
+	_, err = s().Load("", ts.url(""))
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer secret", ts.requests[3].Header.Get("Authorization"))
+
+	// never in cleartext
+	_, err = (&Http{}).Load("", plain.url(""))
+	assert.NoError(t, err)
+	assert.Empty(t, plain.requests[0].Header.Get("Authorization"))
+
+	// unless given in the url
+	u := plain.url("")
+	u.User = url.UserPassword("url-user", "url-password")
+	_, err = (&Http{}).Load("", u)
+	assert.NoError(t, err)
+	user, password, _ = plain.requests[1].BasicAuth()
+	assert.Equal(t, "url-user", user)
+	assert.Equal(t, "url-password", password)
+}
+
+func TestCache(t *testing.T) {
+	ts := newTestServer()
+	dir, err := ioutil.TempDir("", "collect-http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	u := ts.url("/fugu.yml")
+
+	// fetch and keep
+	_, err = (&Http{CacheDir: dir}).Load("label1", u)
+	assert.NoError(t, err)
+
+	// revalidate with the etag
+	d, err := (&Http{CacheDir: dir}).Load("label1", u)
+	assert.NoError(t, err)
+	assert.Equal(t, "my-redis", d.Get("name"))
+	if assert.Len(t, ts.requests, 2) {
+		assert.Equal(t, `"v1"`, ts.requests[1].Header.Get("If-None-Match"))
+	}
+
+	// 4xx are no reason to use the cached copy
+	ts.status = nethttp.StatusForbidden
+	_, err = (&Http{CacheDir: dir}).Load("label1", u)
+	assert.Error(t, err)
+
+	// offline
+	ts.Close()
+	var warning error
+	d, err = (&Http{CacheDir: dir, Warn: func(err error) { warning = err }}).Load("label1", u)
+	assert.NoError(t, err)
+	assert.Equal(t, "my-redis", d.Get("name"))
+	assert.Contains(t, warning.Error(), "using cached copy")
+
+	// nothing cached
+	_, err = (&Http{}).Load("label1", u)
+	assert.Error(t, err)
+}
+
+func TestScheme(t *testing.T) {
+	assert.Equal(t, "http", (&Http{}).Scheme())
+	assert.Equal(t, "https", (&Http{Https: true}).Scheme())
+	assert.Equal(t, "https://example.com/fugu.yml", (&Http{Https: true}).ExampleUrl())
+}
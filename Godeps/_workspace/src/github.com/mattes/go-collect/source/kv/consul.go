@@ -0,0 +1,86 @@
+package kv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	nethttp "net/http"
+	"os"
+	"strings"
+)
+
+// Consul env vars, the token is sent as X-Consul-Token over https or,
+// over http, only to the host of ConsulAddrEnv. If ConsulAddrEnv is set,
+// the token is sent to no other host.
+const (
+	ConsulTokenEnv = "CONSUL_HTTP_TOKEN"
+	ConsulAddrEnv  = "CONSUL_HTTP_ADDR"
+)
+
+// Consul implements Backend with the consul HTTP API,
+// GET /v1/kv/<prefix>?recurse
+type Consul struct {
+	// Https selects the scheme https, otherwise http
+	Https bool
+
+	// Client is used for requests, a client with DefaultTimeout if nil
+	Client *nethttp.Client
+}
+
+func (b *Consul) DefaultPort() string {
+	return "8500"
+}
+
+func (b *Consul) List(host, prefix string) (map[string]string, error) {
+	header := make(map[string]string)
+	if token := os.Getenv(ConsulTokenEnv); token != "" && b.tokenAllowed(host) {
+		header["X-Consul-Token"] = token
+	}
+
+	scheme := "http"
+	if b.Https {
+		scheme = "https"
+	}
+	res, err := get(b.Client, scheme+"://"+host+"/v1/kv/"+prefix+"?recurse", header)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	out := make(map[string]string)
+	if res.StatusCode == nethttp.StatusNotFound {
+		return out, nil
+	}
+
+	// values are base64, decoded by encoding/json into []byte
+	var pairs []struct {
+		Key   string
+		Value []byte
+	}
+	if err := json.NewDecoder(res.Body).Decode(&pairs); err != nil {
+		return nil, fmt.Errorf("source: kv: consul: %v", err.Error())
+	}
+	for _, p := range pairs {
+		out[p.Key] = string(p.Value)
+	}
+	return out, nil
+}
+
+// tokenAllowed returns true if ConsulTokenEnv may be sent to host
+func (b *Consul) tokenAllowed(host string) bool {
+	addr := os.Getenv(ConsulAddrEnv)
+	if addr == "" {
+		return b.Https
+	}
+
+	// CONSUL_HTTP_ADDR is host:port, maybe with scheme. Without
+	// port it matches any port.
+	if i := strings.Index(addr, "://"); i >= 0 {
+		addr = addr[i+3:]
+	}
+	if addr == host {
+		return true
+	}
+	hostname, _, err := net.SplitHostPort(host)
+	return err == nil && addr == hostname
+}
@@ -0,0 +1,59 @@
+package kv
+
+import (
+	"encoding/json"
+	"fmt"
+	nethttp "net/http"
+	"strings"
+)
+
+// Etcd implements Backend with the etcd v2 HTTP API,
+// GET /v2/keys/<prefix>?recursive=true
+type Etcd struct {
+	// Client is used for requests, a client with DefaultTimeout if nil
+	Client *nethttp.Client
+}
+
+type etcdNode struct {
+	Key   string
+	Value string
+	Dir   bool
+	Nodes []etcdNode
+}
+
+func (b *Etcd) DefaultPort() string {
+	return "2379"
+}
+
+func (b *Etcd) List(host, prefix string) (map[string]string, error) {
+	res, err := get(b.Client, "http://"+host+"/v2/keys/"+prefix+"?recursive=true", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	out := make(map[string]string)
+	if res.StatusCode == nethttp.StatusNotFound {
+		return out, nil
+	}
+
+	var body struct {
+		Node etcdNode
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("source: kv: etcd: %v", err.Error())
+	}
+	body.Node.flatten(out)
+	return out, nil
+}
+
+// flatten adds the values of n and its children to out
+func (n etcdNode) flatten(out map[string]string) {
+	if !n.Dir {
+		out[strings.TrimPrefix(n.Key, "/")] = n.Value
+		return
+	}
+	for _, c := range n.Nodes {
+		c.flatten(out)
+	}
+}
@@ -0,0 +1,171 @@
+package kv
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mattes/go-collect/data"
+	"net"
+	nethttp "net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoBackend = errors.New("source: kv: no backend given")
+	ErrStatus    = errors.New("source: kv: unexpected status")
+)
+
+// DefaultTimeout is used by the backends if their Client is nil
+const DefaultTimeout = 10 * time.Second
+
+// Backend reads a key/value store
+type Backend interface {
+	// Return the port used if the url has none, ie 8500
+	DefaultPort() string
+
+	// Return all keys below prefix with their values. Keys are
+	// returned without leading slash, ie prefix/label/key.
+	List(host, prefix string) (map[string]string, error)
+}
+
+// KV implements Source interface. It reads the keys prefix/<label>/<key>
+// of a key/value store. Lists are stored as multiple keys, ie
+// prefix/<label>/publish/0 and prefix/<label>/publish/1.
+type KV struct {
+	// Name is the scheme, ie consul or etcd
+	Name string
+
+	Backend Backend
+
+	labels []string
+}
+
+// NewConsul returns a consul:// source
+func NewConsul() *KV {
+	return &KV{Name: "consul", Backend: &Consul{}}
+}
+
+// NewConsulHttps returns a consuls:// source, it talks https to consul
+func NewConsulHttps() *KV {
+	return &KV{Name: "consuls", Backend: &Consul{Https: true}}
+}
+
+// NewEtcd returns an etcd:// source
+func NewEtcd() *KV {
+	return &KV{Name: "etcd", Backend: &Etcd{}}
+}
+
+func (s *KV) Scheme() string {
+	return s.Name
+}
+
+func (s *KV) ExampleUrl() string {
+	return s.Name + "://localhost/fugu"
+}
+
+func (s *KV) Load(label string, u *url.URL) (*data.Data, error) {
+	if s.Backend == nil {
+		return nil, ErrNoBackend
+	}
+
+	host := u.Host
+	if _, _, err := net.SplitHostPort(host); err != nil && host != "" {
+		host = net.JoinHostPort(host, s.Backend.DefaultPort())
+	}
+	prefix := strings.Trim(u.Path, "/")
+
+	entries, err := s.Backend.List(host, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	byLabel := make(map[string]data.Indexed)
+	for k, v := range entries {
+		k = strings.Trim(k, "/")
+		if prefix != "" {
+			if !strings.HasPrefix(k, prefix+"/") {
+				continue
+			}
+			k = strings.TrimPrefix(k, prefix+"/")
+		}
+
+		// label/key or label/key/index
+		parts := strings.Split(k, "/")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			continue
+		}
+		index := data.PlainIndex
+		if len(parts) == 3 {
+			if index, err = strconv.Atoi(parts[2]); err != nil {
+				continue
+			}
+		}
+
+		if byLabel[parts[0]] == nil {
+			byLabel[parts[0]] = make(data.Indexed)
+		}
+		byLabel[parts[0]].Add(parts[1], index, v)
+	}
+
+	s.labels = make([]string, 0, len(byLabel))
+	for l := range byLabel {
+		s.labels = append(s.labels, l)
+	}
+	sort.Strings(s.labels)
+
+	if v, ok := byLabel[s.selectLabel(label)]; ok {
+		return v.Data(), nil
+	}
+	return data.New(), nil
+}
+
+func (s *KV) Labels() []string {
+	return s.labels
+}
+
+// selectLabel returns the label that should be used, like the file
+// source does: given label if known, "default" or the first label
+func (s *KV) selectLabel(label string) string {
+	for _, l := range s.labels {
+		if l == label {
+			return l
+		}
+	}
+	for _, l := range s.labels {
+		if l == "default" {
+			return l
+		}
+	}
+	if len(s.labels) > 0 {
+		return s.labels[0]
+	}
+	return ""
+}
+
+// get does a GET request and returns the response if the status is
+// 200 or 404, the caller closes the body
+func get(client *nethttp.Client, rawurl string, header map[string]string) (*nethttp.Response, error) {
+	req, err := nethttp.NewRequest("GET", rawurl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("source: kv: %v", err.Error())
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	if client == nil {
+		client = &nethttp.Client{Timeout: DefaultTimeout}
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("source: kv: %v", err.Error())
+	}
+	if res.StatusCode != nethttp.StatusOK && res.StatusCode != nethttp.StatusNotFound {
+		res.Body.Close()
+		return nil, fmt.Errorf("%v %v", ErrStatus.Error(), res.Status)
+	}
+	return res, nil
+}
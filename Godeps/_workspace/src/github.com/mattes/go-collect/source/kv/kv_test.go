@@ -0,0 +1,211 @@
+package kv
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+var testEntries = map[string]string{
+	"fugu/api/image":     "redis",
+	"fugu/api/publish/1": "443",
+	"fugu/api/publish/0": "80",
+	"fugu/web/image":     "nginx",
+	"fugu/web/name":      "my-web",
+	"fugu/api/a/b/c":     "ignored",
+	"other/api/image":    "ignored",
+}
+
+// consulServer stubs GET /v1/kv/<prefix>?recurse
+func consulServer(header *nethttp.Header) *httptest.Server {
+	return httptest.NewServer(consulHandler(header))
+}
+
+func consulHandler(header *nethttp.Header) nethttp.HandlerFunc {
+	return nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		*header = r.Header
+		prefix := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+		if r.URL.Query()["recurse"] == nil {
+			w.WriteHeader(nethttp.StatusBadRequest)
+			return
+		}
+
+		pairs := []string{}
+		for k, v := range testEntries {
+			if strings.HasPrefix(k, prefix) {
+				pairs = append(pairs, fmt.Sprintf(`{"Key": %q, "Value": %q}`, k, base64.StdEncoding.EncodeToString([]byte(v))))
+			}
+		}
+		if len(pairs) == 0 {
+			w.WriteHeader(nethttp.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, "[%v]", strings.Join(pairs, ","))
+	})
+}
+
+// etcdServer stubs GET /v2/keys/fugu?recursive=true
+func etcdServer() *httptest.Server {
+	return httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		if r.URL.Path != "/v2/keys/fugu" || r.URL.Query().Get("recursive") != "true" {
+			w.WriteHeader(nethttp.StatusNotFound)
+			fmt.Fprint(w, `{"errorCode": 100, "message": "Key not found"}`)
+			return
+		}
+		fmt.Fprint(w, `{"action": "get", "node": {"key": "/fugu", "dir": true, "nodes": [
+			{"key": "/fugu/api", "dir": true, "nodes": [
+				{"key": "/fugu/api/image", "value": "redis"},
+				{"key": "/fugu/api/publish", "dir": true, "nodes": [
+					{"key": "/fugu/api/publish/1", "value": "443"},
+					{"key": "/fugu/api/publish/0", "value": "80"}]}]},
+			{"key": "/fugu/web", "dir": true, "nodes": [
+				{"key": "/fugu/web/image", "value": "nginx"},
+				{"key": "/fugu/web/name", "value": "my-web"}]}]}}`)
+	}))
+}
+
+func TestConsul(t *testing.T) {
+	var header nethttp.Header
+	ts := consulServer(&header)
+	defer ts.Close()
+
+	for _, k := range []string{ConsulTokenEnv, ConsulAddrEnv} {
+		defer os.Setenv(k, os.Getenv(k))
+	}
+	os.Setenv(ConsulTokenEnv, "secret")
+	os.Setenv(ConsulAddrEnv, ts.Listener.Addr().String())
+
+	s := NewConsul()
+	d, err := s.Load("api", &url.URL{Scheme: "consul", Host: ts.Listener.Addr().String(), Path: "/fugu"})
+	assert.NoError(t, err)
+	assert.Equal(t, "redis", d.Get("image"))
+	assert.Equal(t, []string{"80", "443"}, d.GetAll("publish"))
+	assert.False(t, d.Exists("a"))
+	assert.Equal(t, []string{"api", "web"}, s.Labels())
+	assert.Equal(t, "secret", header.Get("X-Consul-Token"))
+
+	// first label
+	d, err = s.Load("", &url.URL{Scheme: "consul", Host: ts.Listener.Addr().String(), Path: "/fugu/"})
+	assert.NoError(t, err)
+	assert.Equal(t, "redis", d.Get("image"))
+
+	// unknown label, ie the first arg is a command
+	d, err = s.Load("bash", &url.URL{Scheme: "consul", Host: ts.Listener.Addr().String(), Path: "/fugu"})
+	assert.NoError(t, err)
+	assert.Equal(t, "redis", d.Get("image"))
+
+	// unknown prefix
+	d, err = s.Load("api", &url.URL{Scheme: "consul", Host: ts.Listener.Addr().String(), Path: "/missing"})
+	assert.NoError(t, err)
+	assert.False(t, d.Exists("image"))
+	assert.Len(t, s.Labels(), 0)
+}
+
+func TestConsulToken(t *testing.T) {
+	var header nethttp.Header
+	ts := httptest.NewTLSServer(consulHandler(&header))
+	defer ts.Close()
+	plain := consulServer(&header)
+	defer plain.Close()
+
+	for _, k := range []string{ConsulTokenEnv, ConsulAddrEnv} {
+		defer os.Setenv(k, os.Getenv(k))
+		os.Setenv(k, "")
+	}
+	os.Setenv(ConsulTokenEnv, "secret")
+
+	// trusts the test certificate
+	s := &KV{Name: "consuls", Backend: &Consul{Https: true, Client: &nethttp.Client{Transport: &nethttp.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}}}
+	d, err := s.Load("api", &url.URL{Scheme: "consuls", Host: ts.Listener.Addr().String(), Path: "/fugu"})
+	assert.NoError(t, err)
+	assert.Equal(t, "redis", d.Get("image"))
+	assert.Equal(t, "secret", header.Get("X-Consul-Token"))
+
+	// never in cleartext
+	_, err = NewConsul().Load("api", &url.URL{Scheme: "consul", Host: plain.Listener.Addr().String(), Path: "/fugu"})
+	assert.NoError(t, err)
+	assert.Empty(t, header.Get("X-Consul-Token"))
+
+	// only to the configured host
+	os.Setenv(ConsulAddrEnv, "https://consul.example.com:8501")
+	_, err = s.Load("api", &url.URL{Scheme: "consuls", Host: ts.Listener.Addr().String(), Path: "/fugu"})
+	assert.NoError(t, err)
+	assert.Empty(t, header.Get("X-Consul-Token"))
+
+	// without port any port
+	os.Setenv(ConsulAddrEnv, "127.0.0.1")
+	_, err = NewConsul().Load("api", &url.URL{Scheme: "consul", Host: plain.Listener.Addr().String(), Path: "/fugu"})
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", header.Get("X-Consul-Token"))
+
+	assert.Equal(t, "consuls://localhost/fugu", NewConsulHttps().ExampleUrl())
+}
+
+func TestEtcd(t *testing.T) {
+	ts := etcdServer()
+	defer ts.Close()
+
+	s := NewEtcd()
+	d, err := s.Load("web", &url.URL{Scheme: "etcd", Host: ts.Listener.Addr().String(), Path: "/fugu"})
+	assert.NoError(t, err)
+	assert.Equal(t, "nginx", d.Get("image"))
+	assert.Equal(t, "my-web", d.Get("name"))
+	assert.Equal(t, []string{"api", "web"}, s.Labels())
+
+	d, err = s.Load("api", &url.URL{Scheme: "etcd", Host: ts.Listener.Addr().String(), Path: "/fugu"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"80", "443"}, d.GetAll("publish"))
+
+	_, err = s.Load("api", &url.URL{Scheme: "etcd", Host: ts.Listener.Addr().String(), Path: "/missing"})
+	assert.NoError(t, err)
+}
+
+func TestStatus(t *testing.T) {
+	ts := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		w.WriteHeader(nethttp.StatusForbidden)
+	}))
+	defer ts.Close()
+
+	_, err := NewConsul().Load("api", &url.URL{Scheme: "consul", Host: ts.Listener.Addr().String(), Path: "/fugu"})
+	assert.EqualError(t, err, "source: kv: unexpected status 403 Forbidden")
+}
+
+// fakeBackend returns its entries and remembers the host
+type fakeBackend struct {
+	host string
+}
+
+func (b *fakeBackend) DefaultPort() string {
+	return "1234"
+}
+
+func (b *fakeBackend) List(host, prefix string) (map[string]string, error) {
+	b.host = host
+	return testEntries, nil
+}
+
+func TestBackend(t *testing.T) {
+	b := &fakeBackend{}
+	s := &KV{Name: "fake", Backend: b}
+	assert.Equal(t, "fake://localhost/fugu", s.ExampleUrl())
+
+	d, err := s.Load("web", &url.URL{Scheme: "fake", Host: "kv.example.com", Path: "/fugu"})
+	assert.NoError(t, err)
+	assert.Equal(t, "kv.example.com:1234", b.host)
+	assert.Equal(t, "my-web", d.Get("name"))
+
+	_, err = s.Load("web", &url.URL{Scheme: "fake", Host: "kv.example.com:5678", Path: "/fugu"})
+	assert.NoError(t, err)
+	assert.Equal(t, "kv.example.com:5678", b.host)
+
+	_, err = (&KV{Name: "fake"}).Load("web", &url.URL{Scheme: "fake", Host: "localhost", Path: "/fugu"})
+	assert.Equal(t, ErrNoBackend, err)
+}
@@ -0,0 +1,113 @@
+package fugu
+
+import (
+	"fmt"
+	"github.com/mattes/go-collect"
+	"github.com/mattes/go-collect/data"
+	"net/url"
+	"os"
+)
+
+// Version of fugu
+const Version = "1.1.1"
+
+// FugufileSearchpaths are used as default source, the first found wins
+var FugufileSearchpaths = []string{
+	"fugu.yml", "fugu.yaml", ".fugu.yml", ".fugu.yaml",
+	"fugu.toml", ".fugu.toml", "fugu.json", ".fugu.json"}
+
+// LayerSources are loaded after the fugu file or --source, if
+// their scheme is registered, but before the command line options
+var LayerSources = []string{"env://"}
+
+// CacheDir keeps fetched remote sources, i.e. for http(s)://
+var CacheDir = "~/.cache/fugu"
+
+// Main runs fugu with args, the args after the program name, and
+// returns the exit code. Register sources and commands before.
+// Several labels run in copies of the binary, so call it with
+// os.Args[1:] from main().
+func Main(args []string) int {
+	// get command
+	var command string
+	if len(args) > 0 {
+		command = args[0]
+		args = args[1:]
+	}
+
+	// create new collect object
+	c := collect.New()
+
+	// set default source if fugu file is found in search path
+	for _, p := range FugufileSearchpaths {
+		if _, err := os.Stat(p); err == nil {
+			// TODO expand ~ in p
+			c.SetDefaultSource("file://" + p)
+			break
+		}
+	}
+
+	for _, l := range LayerSources {
+		if u, err := url.Parse(l); err == nil && collect.GetSource(u.Scheme) != nil {
+			c.AddLayer(l)
+		}
+	}
+
+	switch command {
+	case "--version":
+		fmt.Println(Version)
+		return 0
+
+	case "", "--help":
+		WriteUsage(os.Stderr, Plugins()...)
+		return 0
+	}
+
+	cmd := Lookup(command)
+	if cmd == nil {
+		cmd = LookupPlugin(command)
+	}
+	if cmd == nil {
+		WriteUsage(os.Stderr, Plugins()...)
+		fmt.Println()
+		return exitCode("unkown command")
+	}
+
+	return exitCode(cmd.Exec(c, args))
+}
+
+// exitCode prints msg and returns the exit code for it
+func exitCode(msg interface{}) int {
+	if msg == nil {
+		return 0
+	}
+
+	// docker already printed its error, just pass on its exit code
+	if err, ok := msg.(*ExitError); ok {
+		return err.Code
+	}
+
+	fmt.Fprintf(os.Stderr, "Error: %v\n", msg)
+	return 1
+}
+
+// cmdHelp prints the usage of fugu or of a command
+func cmdHelp(c *collect.Collector, p *data.Data, args []string) error {
+	if len(args) > 0 {
+		if cmd := Lookup(args[0]); cmd != nil {
+			WriteCommandUsage(os.Stderr, cmd, c.GetDefaultSource())
+			return nil
+		}
+		// plugins print their own help
+		if cmd := LookupPlugin(args[0]); cmd != nil {
+			return cmd.Run(c, p, []string{"--help"})
+		}
+	}
+	WriteUsage(os.Stderr, Plugins()...)
+	return nil
+}
+
+// cmdMan prints the docs of all commands
+func cmdMan(c *collect.Collector, p *data.Data, args []string) error {
+	return WriteDocs(os.Stdout, p.Get("format"), Version)
+}
@@ -0,0 +1,72 @@
+package fugu
+
+import (
+	"github.com/mattes/go-collect/data"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Cmd is a docker command with its flags and arguments
+type Cmd struct {
+	// Command is the docker sub command, i.e. run
+	Command string
+
+	// Flags are passed to docker as --name=value options
+	Flags *data.Data
+
+	// Args are passed to docker after the flags
+	Args []string
+}
+
+// Argv returns the program and its arguments as passed to exec.Command
+func (c *Cmd) Argv() []string {
+	argv := []string{"docker", c.Command}
+
+	opts := []string{}
+	if c.Flags != nil {
+		for _, n := range c.Flags.Keys() {
+			for _, o := range c.Flags.GetAll(n) {
+				opts = append(opts, dockerOpt(n, o))
+			}
+		}
+	}
+	sort.Sort(sort.StringSlice(opts))
+
+	argv = append(argv, opts...)
+	return append(argv, c.Args...)
+}
+
+// String returns a shell-safe rendering of the command.
+// It is meant for printing only, the command is never run through a shell.
+func (c *Cmd) String() string {
+	argv := c.Argv()
+	out := make([]string, 0, len(argv))
+	for _, a := range argv {
+		if strings.HasPrefix(a, "--") && strings.Contains(a, "=") {
+			kv := strings.SplitN(a, "=", 2)
+			out = append(out, kv[0]+"="+shellQuote(kv[1]))
+		} else {
+			out = append(out, shellQuote(a))
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// dockerOpt formats a single docker option
+func dockerOpt(name, value string) string {
+	if value == "true" {
+		return "--" + name
+	}
+	return "--" + name + "=" + value
+}
+
+var shellSafe = regexp.MustCompile(`^[a-zA-Z0-9_@%+=:,./-]+$`)
+
+// shellQuote quotes s, so that it is read as one word by sh
+func shellQuote(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
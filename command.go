@@ -0,0 +1,331 @@
+package fugu
+
+import (
+	"github.com/mattes/go-collect"
+	"github.com/mattes/go-collect/data"
+	"github.com/mattes/go-collect/flags"
+	"os"
+	"strings"
+)
+
+// DockerFunc returns the docker command a Command runs
+type DockerFunc func(c *collect.Collector, p *data.Data, args []string) (*Cmd, error)
+
+// RunFunc runs a Command, it usually prints to stdout/stderr directly
+type RunFunc func(c *collect.Collector, p *data.Data, args []string) error
+
+// Command is a fugu command. Either Docker or Run handles it.
+type Command struct {
+	Name string
+
+	// Synopsis is listed by fugu help
+	Synopsis string
+
+	// Args follow the command name, i.e. [LABEL] [OPTIONS] [TAG]
+	Args string
+
+	// Description is shown by fugu help COMMAND, Synopsis if empty
+	Description string
+
+	// FuguFlags are parsed, DockerFlags are passed on to docker, too
+	FuguFlags   *flags.Flags
+	DockerFlags *flags.Flags
+
+	// MaxArgs is the number of args allowed after label and options,
+	// -1 allows any number
+	MaxArgs int
+
+	// Docker returns the docker command to run
+	Docker DockerFunc
+
+	// Run is used if Docker is nil
+	Run RunFunc
+
+	// Hooks runs the pre-NAME and post-NAME hooks of the label
+	// before and after the command, see runHooks
+	Hooks bool
+
+	// RawArgs passes args to Run without parsing, p is empty
+	RawArgs bool
+
+	// Hidden commands are not listed by fugu help
+	Hidden bool
+}
+
+// commands are the registered commands in the order fugu help lists them
+var commands = make([]*Command, 0)
+
+// Register adds a command. It replaces a registered command of
+// the same name. Register commands before calling Main.
+func Register(cmd *Command) {
+	if cmd == nil || cmd.Name == "" {
+		panic("fugu: Register command without name")
+	}
+	if cmd.Docker == nil && cmd.Run == nil {
+		panic("fugu: Register command " + cmd.Name + " without Docker or Run")
+	}
+	for i, c := range commands {
+		if c.Name == cmd.Name {
+			commands[i] = cmd
+			return
+		}
+	}
+	commands = append(commands, cmd)
+}
+
+// Lookup returns the registered command or nil
+func Lookup(name string) *Command {
+	for _, c := range commands {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// CommandList returns all registered commands
+func CommandList() []*Command {
+	return append([]*Command{}, commands...)
+}
+
+// Flags returns the fugu and docker flags of the command
+func (cmd *Command) Flags() []*flags.Flags {
+	fs := make([]*flags.Flags, 0, 2)
+	for _, f := range []*flags.Flags{cmd.FuguFlags, cmd.DockerFlags} {
+		if f != nil {
+			fs = append(fs, f)
+		}
+	}
+	return fs
+}
+
+// Usage returns the usage line
+func (cmd *Command) Usage() string {
+	return strings.TrimSpace("fugu " + cmd.Name + " " + cmd.Args)
+}
+
+// Text returns Description or Synopsis
+func (cmd *Command) Text() string {
+	if cmd.Description != "" {
+		return strings.TrimSpace(cmd.Description)
+	}
+	return cmd.Synopsis
+}
+
+// Exec parses args and runs the command. If args select
+// several labels, it runs once per label, see MultiLabel.
+func (cmd *Command) Exec(c *collect.Collector, args []string) error {
+	if cmd.RawArgs {
+		return cmd.Run(c, data.New(), args)
+	}
+
+	p, remainingArgs, err := c.Parse(args, cmd.Flags()...)
+	if err != nil {
+		return err
+	}
+
+	if cmd.FuguFlags != nil && cmd.FuguFlags.Exists("labels") {
+		m, err := ParseMultiLabel(c, args)
+		if err != nil {
+			return err
+		}
+		if m != nil {
+			return m.Run(cmd.Name, os.Stdout, os.Stderr)
+		}
+	}
+
+	if p.IsTrue("help") {
+		WriteCommandUsage(os.Stderr, cmd, c.GetDefaultSource())
+		return nil
+	}
+
+	if cmd.MaxArgs >= 0 && len(remainingArgs) > cmd.MaxArgs {
+		return ErrTooManyArgs
+	}
+
+	if cmd.Hooks {
+		if err := runHooks(c, p, PreHook, cmd.Name); err != nil {
+			return err
+		}
+	}
+
+	if err := cmd.run(c, p, remainingArgs); err != nil {
+		return err
+	}
+
+	if cmd.Hooks {
+		return runHooks(c, p, PostHook, cmd.Name)
+	}
+	return nil
+}
+
+// run runs Docker or Run
+func (cmd *Command) run(c *collect.Collector, p *data.Data, args []string) error {
+	if cmd.Docker == nil {
+		return cmd.Run(c, p, args)
+	}
+
+	dc, err := cmd.Docker(c, p, args)
+	if err != nil {
+		return err
+	}
+	return ExecCommand(p, dc)
+}
+
+func init() {
+	Register(&Command{Name: "build", Synopsis: "Build an image from a Dockerfile",
+		Args:        "[LABEL] [OPTIONS] [PATH | URL]",
+		Description: "Build a new image from the source code at PATH",
+		FuguFlags:   FuguFlags["build"], DockerFlags: DockerFlags["build"],
+		MaxArgs: 1, Docker: cmdBuild, Hooks: true})
+
+	Register(&Command{Name: "run", Synopsis: "Run a command in a new container",
+		Args:      "[LABEL] [OPTIONS] [COMMAND] [ARG...]",
+		FuguFlags: FuguFlags["run"], DockerFlags: DockerFlags["run"],
+		MaxArgs: -1, Docker: cmdRun, Hooks: true})
+
+	Register(&Command{Name: "exec", Synopsis: "Run a command in a running container",
+		Args:      "[LABEL] [OPTIONS] [COMMAND] [ARG...]",
+		FuguFlags: FuguFlags["exec"], DockerFlags: DockerFlags["exec"],
+		MaxArgs: -1, Docker: cmdExec})
+
+	Register(&Command{Name: "shell", Synopsis: "Open a shell in a running container",
+		Args:      "[LABEL] [OPTIONS]",
+		FuguFlags: FuguFlags["shell"], DockerFlags: DockerFlags["shell"],
+		MaxArgs: 0, Docker: cmdShell})
+
+	Register(&Command{Name: "destroy", Synopsis: "Kill a running container and remove it",
+		Args:      "[LABEL]",
+		FuguFlags: FuguFlags["destroy"], DockerFlags: DockerFlags["destroy"],
+		MaxArgs: 0, Docker: cmdDestroy, Hooks: true})
+
+	Register(&Command{Name: "logs", Synopsis: "Fetch the logs of a container",
+		Args:      "[LABEL] [OPTIONS]",
+		FuguFlags: FuguFlags["logs"], DockerFlags: DockerFlags["logs"],
+		MaxArgs: 0, Docker: cmdLogs})
+
+	// lifecycle commands only need the container name
+	lifecycle := []struct{ name, synopsis, args string }{
+		{"start", "Start a stopped container", "[LABEL] [OPTIONS]"},
+		{"stop", "Stop a running container", "[LABEL] [OPTIONS]"},
+		{"restart", "Restart a running container", "[LABEL] [OPTIONS]"},
+		{"kill", "Kill a running container", "[LABEL] [OPTIONS]"},
+		{"pause", "Pause all processes within a container", "[LABEL]"},
+		{"unpause", "Unpause a paused container", "[LABEL]"},
+	}
+	for _, l := range lifecycle {
+		Register(&Command{Name: l.name, Synopsis: l.synopsis, Args: l.args,
+			FuguFlags: FuguFlags[l.name], DockerFlags: DockerFlags[l.name],
+			MaxArgs: 0, Docker: containerCommand(l.name)})
+	}
+
+	Register(&Command{Name: "push", Synopsis: "Push an image or a repository to the registry",
+		Args:      "[LABEL] [OPTIONS] [TAG]",
+		FuguFlags: FuguFlags["push"], DockerFlags: DockerFlags["push"],
+		MaxArgs: 1, Docker: cmdPush})
+
+	Register(&Command{Name: "pull", Synopsis: "Pull an image or a repository from the registry",
+		Args:      "[LABEL] [OPTIONS] [TAG]",
+		FuguFlags: FuguFlags["pull"], DockerFlags: DockerFlags["pull"],
+		MaxArgs: 1, Docker: cmdPull})
+
+	Register(&Command{Name: "images", Synopsis: "List images (from remote registry)",
+		Args:      "[REGISTRY]",
+		FuguFlags: FuguFlags["images"], DockerFlags: DockerFlags["images"],
+		MaxArgs: 1, Run: cmdImages})
+
+	Register(&Command{Name: "up", Synopsis: "Build and run a container, if it changed",
+		Args: "[LABEL] [OPTIONS] [COMMAND] [ARG...]",
+		Description: `
+Build the image if path or url is set and run the container detached.
+An existing container is only replaced if its config or image changed,
+a stopped one is started. Safe to run repeatedly.`,
+		FuguFlags: FuguFlags["up"], DockerFlags: DockerFlags["up"],
+		MaxArgs: -1, Run: up})
+
+	Register(&Command{Name: "deploy", Synopsis: "Replace a container without downtime",
+		Args: "[LABEL] [OPTIONS] [COMMAND] [ARG...]",
+		Description: `
+Replace a container without downtime. The new container is started
+next to the old one and must get healthy or answer on its published
+ports, before the old one is removed. Otherwise it is rolled back.
+Host ports must be dynamic, i.e. publish: 80 or 127.0.0.1::80, and a
+proxy in front finds the new port. Fixed ports like publish: 8080:80
+need --stop-first, which stops the old container before the new one
+starts. That is a short downtime, on rollback the old one is started.`,
+		FuguFlags: FuguFlags["deploy"], DockerFlags: DockerFlags["deploy"],
+		MaxArgs: -1, Run: deploy})
+
+	Register(&Command{Name: "status", Synopsis: "Show the status of containers",
+		Args: "[LABEL] [OPTIONS]",
+		Description: `
+Show if the container of a label exists, is running and runs the
+current image. Without label, show the status of all labels.`,
+		FuguFlags: FuguFlags["status"], DockerFlags: DockerFlags["status"],
+		MaxArgs: 0, Run: cmdStatus})
+
+	Register(&Command{Name: "diff", Synopsis: "Show how a container differs from its config",
+		Args: "[LABEL] [OPTIONS] [COMMAND] [ARG...]",
+		Description: `
+Show how the container of a label differs from what fugu run would
+run now. Lines with - are found in the container, lines with + in the
+config. Exits with 1 if they differ.`,
+		FuguFlags: FuguFlags["diff"], DockerFlags: DockerFlags["diff"],
+		MaxArgs: -1, Run: cmdDiff})
+
+	Register(&Command{Name: "task", Synopsis: "Run a task of the label",
+		Args: "[LABEL] [OPTIONS] TASK [ARG...]",
+		Description: `
+Run a task defined in tasks of the label, in its running container.
+Tasks with rm: true run in a new container, removed afterwards.
+ARGs are appended to the command of the task.
+
+app:
+  tasks:
+    flush: redis-cli flushall
+    migrate:
+      command: rake db:migrate
+      env: [RAILS_ENV=production]
+    test:
+      command: [rake, test]
+      rm: true`,
+		FuguFlags: FuguFlags["task"], DockerFlags: DockerFlags["task"],
+		MaxArgs: -1, Run: cmdTask})
+
+	Register(&Command{Name: "show-data", Synopsis: "Show aggregated data for label",
+		Args:      "[LABEL] [OPTIONS]",
+		FuguFlags: FuguFlags["show-data"], DockerFlags: DockerFlags["show-data"],
+		MaxArgs: 1, Run: cmdShowData})
+
+	Register(&Command{Name: "show-labels", Synopsis: "Show all labels",
+		Args:      "[OPTIONS]",
+		FuguFlags: FuguFlags["show-labels"], DockerFlags: DockerFlags["show-labels"],
+		MaxArgs: 0, Run: cmdShowLabels})
+
+	Register(&Command{Name: "completion", Synopsis: "Print a shell completion script",
+		Args: "bash|zsh|fish",
+		Description: `
+Print a shell completion script. Labels are completed from the
+fugu.yml of the current directory.
+
+bash: source <(fugu completion bash)
+zsh:  source <(fugu completion zsh)
+fish: fugu completion fish | source`,
+		MaxArgs: 1, Run: cmdCompletion})
+
+	Register(&Command{Name: "man", Synopsis: "Print the man page or markdown docs",
+		Args: "[OPTIONS]",
+		Description: `
+Print the man page, markdown docs or usage.txt of all commands.
+
+fugu man > /usr/local/share/man/man1/fugu.1`,
+		FuguFlags: FuguFlags["man"],
+		MaxArgs:   0, Run: cmdMan})
+
+	Register(&Command{Name: "help", Synopsis: "Show help", Args: "[COMMAND]",
+		RawArgs: true, Run: cmdHelp})
+
+	// __complete is called by the completion scripts
+	Register(&Command{Name: "__complete", Hidden: true,
+		RawArgs: true, Run: cmdComplete})
+}
@@ -0,0 +1,193 @@
+package fugu
+
+import (
+	"fmt"
+	"github.com/mattes/go-collect"
+	"github.com/mattes/go-collect/data"
+	"sort"
+	"strings"
+)
+
+// CompletionScripts source `fugu __complete WORDS...` for candidates
+var CompletionScripts = map[string]string{
+	"bash": `# fugu bash completion, i.e. source <(fugu completion bash)
+# COMP_WORDS is split at = and :, so --source=file://x.yml would be
+# several words. Use bash-completion or split COMP_LINE at blanks.
+_fugu() {
+    local cur words cword
+    if declare -F _get_comp_words_by_ref >/dev/null; then
+        _get_comp_words_by_ref -n =: cur words cword
+    else
+        local line="${COMP_LINE:0:COMP_POINT}"
+        read -ra words <<< "$line"
+        [[ "$line" == *[[:blank:]] ]] && words+=("")
+        cword=$((${#words[@]} - 1))
+        cur="${words[cword]}"
+    fi
+
+    local IFS=$'\n'
+    COMPREPLY=($(fugu __complete "${words[@]:1:cword}" 2>/dev/null))
+
+    # bash only replaces the part of cur after its last = or :
+    local prefix="${cur%"${cur##*[=:]}"}"
+    [[ -n "$prefix" ]] && COMPREPLY=("${COMPREPLY[@]#"$prefix"}")
+}
+complete -o default -F _fugu fugu
+`,
+
+	"zsh": `#compdef fugu
+# fugu zsh completion, i.e. source <(fugu completion zsh)
+_fugu() {
+    local -a candidates
+    candidates=(${(f)"$(fugu __complete "${(@)words[2,CURRENT]}" 2>/dev/null)"})
+    compadd -a candidates
+}
+compdef _fugu fugu
+`,
+
+	"fish": `# fugu fish completion, i.e. fugu completion fish | source
+function __fugu_complete
+    set -l words (commandline -opc) (commandline -ct)
+    fugu __complete $words[2..-1] 2>/dev/null
+end
+complete -c fugu -f -a '(__fugu_complete)'
+`,
+}
+
+// cmdCompletion prints the completion script of a shell
+func cmdCompletion(c *collect.Collector, p *data.Data, args []string) error {
+	// the shell is no label, but might be parsed as one
+	if c.Label() != "" {
+		args = append([]string{c.Label()}, args...)
+	}
+	if len(args) == 0 {
+		return ErrMissingShell
+	}
+	if len(args) > 1 {
+		return ErrTooManyArgs
+	}
+
+	script, ok := CompletionScripts[args[0]]
+	if !ok {
+		return ErrUnknownShell
+	}
+	fmt.Print(script)
+	return nil
+}
+
+// cmdComplete prints the candidates of Complete, one per line
+func cmdComplete(c *collect.Collector, p *data.Data, args []string) error {
+	for _, s := range Complete(c, args) {
+		fmt.Println(s)
+	}
+	return nil
+}
+
+// CommandNames returns the names of all commands, sorted
+func CommandNames() []string {
+	names := make([]string, 0, len(commands))
+	for _, cmd := range visibleCommands() {
+		names = append(names, cmd.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Complete returns the candidates for the last of words, the words
+// typed after fugu. Labels and groups are read from the sources.
+func Complete(c *collect.Collector, words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	current := words[len(words)-1]
+	command, args := words[0], []string{}
+	if len(words) > 1 {
+		args = words[1 : len(words)-1]
+	}
+
+	names := append(CommandNames(), Plugins()...)
+	candidates := make([]string, 0)
+	switch {
+	case len(words) == 1:
+		candidates = names
+
+	case command == "help" && len(args) == 0:
+		candidates = names
+
+	case command == "completion" && len(args) == 0:
+		for shell := range CompletionScripts {
+			candidates = append(candidates, shell)
+		}
+
+	case strings.HasPrefix(current, "-"):
+		candidates = append(candidates, "--help")
+		cmd := Lookup(command)
+		if cmd == nil {
+			cmd = LookupPlugin(command)
+		}
+		if cmd == nil {
+			break
+		}
+		for _, fs := range cmd.Flags() {
+			keys, err := fs.Keys()
+			if err != nil {
+				continue
+			}
+			for _, k := range keys {
+				if !containsString(candidates, "--"+k) {
+					candidates = append(candidates, "--"+k)
+				}
+			}
+		}
+
+	case firstArg(args) && containsString(names, command):
+		// the label is the first arg
+		sources := make([]string, 0)
+		for _, a := range args {
+			if name, value, ok := splitFlag(a); name == "source" && ok {
+				sources = append(sources, value)
+			}
+		}
+		sc, err := sourceCollector(c, sources)
+		if err != nil {
+			return nil
+		}
+		candidates = append(candidates, sc.Labels()...)
+		for g := range sc.Groups() {
+			candidates = append(candidates, g)
+		}
+	}
+
+	out := make([]string, 0, len(candidates))
+	for _, cand := range candidates {
+		if strings.HasPrefix(cand, current) {
+			out = append(out, cand)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// firstArg is true if args has no positional arg yet
+func firstArg(args []string) bool {
+	for _, a := range args {
+		if !strings.HasPrefix(a, "-") {
+			return false
+		}
+	}
+	return true
+}
+
+// sourceCollector returns a collector for the sources, or the default source of c
+func sourceCollector(c *collect.Collector, sources []string) (*collect.Collector, error) {
+	sc := collect.New()
+	sc.SetDefaultSource(c.GetDefaultSource())
+	args := make([]string, 0, len(sources))
+	for _, s := range sources {
+		args = append(args, "--source="+s)
+	}
+	if _, _, err := sc.Parse(args); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
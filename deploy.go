@@ -0,0 +1,149 @@
+package fugu
+
+import (
+	"fmt"
+	"github.com/docker/docker/nat"
+	"github.com/mattes/go-collect"
+	"github.com/mattes/go-collect/data"
+	"os"
+)
+
+// DefaultDeployTimeout is used if deploy-timeout is not set
+const DefaultDeployTimeout = 60
+
+// deploySuffix is appended to name for the new container
+const deploySuffix = "-fugu-next"
+
+// deploy starts the new container next to the old one, waits until
+// it is ready (see waitFor and containerReady), then removes the old
+// container and renames the new one. A new container that doesn't
+// get ready is removed again and the old one keeps running.
+// With stop-first, the old container is stopped before the new one
+// starts and started again if the new one doesn't get ready.
+func deploy(c *collect.Collector, p *data.Data, args []string) error {
+	name := p.Get("name")
+	if name == "" {
+		return ErrMissingName
+	}
+	next := name + deploySuffix
+	stopFirst := p.IsTrue("stop-first")
+
+	// the old and new container can't bind the same host port
+	_, bindings, err := nat.ParsePortSpecs(p.GetAll("publish"))
+	if err != nil {
+		return fmt.Errorf("deploy: %v", err.Error())
+	}
+	for _, b := range bindings {
+		for _, bb := range b {
+			if bb.HostPort != "" && !stopFirst {
+				return ErrFixedHostPort
+			}
+		}
+	}
+
+	ins, err := newInspector(p.Get("backend"))
+	if err != nil {
+		return err
+	}
+
+	timeout, err := secondsFlag(p, "deploy-timeout", DefaultDeployTimeout)
+	if err != nil {
+		return err
+	}
+
+	// wait for the wait-for conditions, or health and published ports
+	w, err := newWaitFor(p)
+	if err != nil {
+		return err
+	}
+	ready := containerReady
+	if w != nil {
+		ready = func(c *containerJSON) (bool, error) {
+			return w.ready(ins, c)
+		}
+	}
+
+	// the hash label is computed with the final name
+	rp := data.Merge(p)
+	rp.SetTrue("detach")
+	rp.Delete("rm")
+	runCmd, err := cmdRun(c, rp, args)
+	if err != nil {
+		return err
+	}
+	runCmd.Flags.Set("name", next)
+
+	destroy := func(name string) error {
+		cmd, err := cmdDestroy(c, data.New().Set("name", name), nil)
+		if err != nil {
+			return err
+		}
+		return execOrPrint(p, cmd)
+	}
+
+	// remove leftovers of a failed deploy
+	leftover, err := ins.inspectContainer(next)
+	if err != nil {
+		return err
+	}
+	if leftover != nil {
+		if err := destroy(next); err != nil {
+			return err
+		}
+	}
+
+	// the old container is started again on rollback
+	stopped := false
+	if stopFirst {
+		running, err := ins.inspectContainer(name)
+		if err != nil {
+			return err
+		}
+		if running != nil && running.State.Running {
+			if err := execOrPrint(p, buildDockerCmd("stop", data.New(), name)); err != nil {
+				return err
+			}
+			stopped = true
+		}
+	}
+
+	if err := execOrPrint(p, runCmd); err != nil {
+		if stopped {
+			execOrPrint(p, buildDockerCmd("start", data.New(), name))
+		}
+		return err
+	}
+
+	if !p.IsTrue("dry-run") {
+		if err := waitReady(ins, next, timeout, ready); err != nil {
+			fmt.Fprintf(os.Stderr, "deploy: %v, rolling back\n", err.Error())
+			printLastLogs(ins, next)
+			if rerr := destroy(next); rerr != nil {
+				return rerr
+			}
+			if stopped {
+				if rerr := execOrPrint(p, buildDockerCmd("start", data.New(), name)); rerr != nil {
+					return rerr
+				}
+			}
+			return ErrDeployFailed
+		}
+	}
+
+	old, err := ins.inspectContainer(name)
+	if err != nil {
+		return err
+	}
+	if old != nil {
+		if err := destroy(name); err != nil {
+			return err
+		}
+	}
+
+	if err := execOrPrint(p, buildDockerCmd("rename", data.New(), next, name)); err != nil {
+		return err
+	}
+
+	fmt.Printf("%v: deployed\n", name)
+	return nil
+}
@@ -0,0 +1,299 @@
+package fugu
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/docker/docker/nat"
+	"github.com/mattes/go-collect/data"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ConfigHashLabel is the docker label fugu run stamps named containers with
+const ConfigHashLabel = "fugu.hash"
+
+// hashIgnoredFlags only affect how docker run is attached, not the container
+var hashIgnoredFlags = []string{"detach", "rm", "sig-proxy", "attach", "interactive", "cidfile"}
+
+// configHash hashes the docker run flags and args of a container
+func configHash(p *data.Data, args []string) string {
+	h := data.New()
+	h.Merge(p)
+	for _, f := range hashIgnoredFlags {
+		h.Delete(f)
+	}
+
+	h.Set("label", withoutHashLabel(p.GetAll("label"))...)
+
+	cmd := &Cmd{Command: "run", Flags: h, Args: args}
+	sum := sha256.Sum256([]byte(strings.Join(cmd.Argv(), "\x00")))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// withoutHashLabel removes the ConfigHashLabel from docker labels
+func withoutHashLabel(labels []string) []string {
+	out := make([]string, 0, len(labels))
+	for _, l := range labels {
+		if l != ConfigHashLabel && !strings.HasPrefix(l, ConfigHashLabel+"=") {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// FieldDiff is a difference between the container and its config
+type FieldDiff struct {
+	Field string
+
+	// Have is found in the container, Want in the config
+	Have []string
+	Want []string
+}
+
+// configDiff compares a container with the run command fugu would run now.
+// wantImage is the configured image, haveImage the image of the container,
+// both may be nil.
+func configDiff(container *containerJSON, haveImage *imageJSON, cmd *Cmd, wantImage *imageJSON) ([]FieldDiff, error) {
+	want, err := engineContainerConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+	have := &container.Config
+	wantHc, haveHc := &want.HostConfig, &container.HostConfig
+	if haveImage == nil {
+		haveImage = &imageJSON{}
+	}
+	if wantImage == nil {
+		wantImage = &imageJSON{}
+	}
+
+	// unset values fall back to the image's config
+	if len(want.Cmd) == 0 && len(want.Entrypoint) == 0 {
+		want.Cmd = wantImage.Config.Cmd
+	}
+	if len(want.Entrypoint) == 0 {
+		want.Entrypoint = wantImage.Config.Entrypoint
+	}
+	if want.User == "" {
+		want.User = wantImage.Config.User
+	}
+	if want.WorkingDir == "" {
+		want.WorkingDir = wantImage.Config.WorkingDir
+	}
+
+	// docker run takes env variables without value from the host
+	env := make([]string, 0, len(want.Env))
+	for _, e := range want.Env {
+		if strings.Contains(e, "=") {
+			env = append(env, e)
+		} else if v := os.Getenv(e); v != "" {
+			env = append(env, e+"="+v)
+		}
+	}
+	want.Env = env
+
+	wantLabels := make(map[string]string)
+	for k, v := range want.Labels {
+		wantLabels[k] = v
+	}
+	haveHash := have.Labels[ConfigHashLabel]
+	wantHash := wantLabels[ConfigHashLabel]
+	delete(wantLabels, ConfigHashLabel)
+
+	fields := []FieldDiff{
+		{"image", []string{have.Image}, []string{want.Image}},
+		{"command", []string{strings.Join(have.Cmd, " ")}, []string{strings.Join(want.Cmd, " ")}},
+		{"entrypoint", []string{strings.Join(have.Entrypoint, " ")}, []string{strings.Join(want.Entrypoint, " ")}},
+		{"env", withoutImage(have.Env, haveImage.Config.Env, want.Env), want.Env},
+		{"label", withoutImage(labelList(have.Labels, ConfigHashLabel), labelList(haveImage.Config.Labels, ""), labelList(wantLabels, "")), labelList(wantLabels, "")},
+		{"publish", portList(haveHc.PortBindings), portList(wantHc.PortBindings)},
+		{"volume", volumeList(haveHc.Binds, have.Volumes, haveImage.Config.Volumes), volumeList(wantHc.Binds, want.Volumes, nil)},
+		{"link", linkList(haveHc.Links), linkList(wantHc.Links)},
+		{"restart", []string{restartPolicy(haveHc.RestartPolicy)}, []string{restartPolicy(wantHc.RestartPolicy)}},
+		{"net", []string{networkMode(haveHc.NetworkMode)}, []string{networkMode(wantHc.NetworkMode)}},
+		{"user", []string{have.User}, []string{want.User}},
+		{"workdir", []string{have.WorkingDir}, []string{want.WorkingDir}},
+		{"memory", []string{fmt.Sprintf("%v", haveHc.Memory)}, []string{fmt.Sprintf("%v", wantHc.Memory)}},
+		{"privileged", []string{fmt.Sprintf("%v", haveHc.Privileged)}, []string{fmt.Sprintf("%v", wantHc.Privileged)}},
+		{"cap-add", haveHc.CapAdd, wantHc.CapAdd},
+		{"cap-drop", haveHc.CapDrop, wantHc.CapDrop},
+		{"dns", haveHc.Dns, wantHc.Dns},
+		{"add-host", haveHc.ExtraHosts, wantHc.ExtraHosts},
+		{"volumes-from", haveHc.VolumesFrom, wantHc.VolumesFrom},
+		{ConfigHashLabel, []string{haveHash}, []string{wantHash}},
+	}
+
+	// docker makes up a hostname, only compare it if it is configured
+	if want.Hostname != "" {
+		fields = append(fields, FieldDiff{"hostname", []string{have.Hostname}, []string{want.Hostname}})
+	}
+
+	// the image might be retagged, so compare IDs too
+	if wantImage.Id != "" && wantImage.Id != container.Image {
+		fields = append(fields, FieldDiff{"image id", []string{container.Image}, []string{wantImage.Id}})
+	}
+
+	diffs := make([]FieldDiff, 0)
+	for _, f := range fields {
+		if d, ok := diffList(f); ok {
+			diffs = append(diffs, d)
+		}
+	}
+	return diffs, nil
+}
+
+// diffList reduces f to the values only found on one side
+func diffList(f FieldDiff) (d FieldDiff, changed bool) {
+	count := make(map[string]int)
+	for _, v := range f.Have {
+		if v != "" {
+			count[v]++
+		}
+	}
+	for _, v := range f.Want {
+		if v != "" {
+			count[v]--
+		}
+	}
+
+	d.Field = f.Field
+	for v, n := range count {
+		for ; n > 0; n-- {
+			d.Have = append(d.Have, v)
+		}
+		for ; n < 0; n++ {
+			d.Want = append(d.Want, v)
+		}
+	}
+	sort.Strings(d.Have)
+	sort.Strings(d.Want)
+	return d, len(d.Have) > 0 || len(d.Want) > 0
+}
+
+// withoutImage removes values inherited from the image unless they are wanted
+func withoutImage(values, image, want []string) []string {
+	inherited := make(map[string]bool)
+	for _, v := range image {
+		inherited[v] = true
+	}
+	for _, v := range want {
+		delete(inherited, v)
+	}
+
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if !inherited[v] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func labelList(labels map[string]string, skip string) []string {
+	out := make([]string, 0, len(labels))
+	for k, v := range labels {
+		if k != skip {
+			out = append(out, k+"="+v)
+		}
+	}
+	return out
+}
+
+func portList(ports nat.PortMap) []string {
+	out := make([]string, 0)
+	for port, bindings := range ports {
+		for _, b := range bindings {
+			out = append(out, fmt.Sprintf("%v:%v->%v", b.HostIp, b.HostPort, port))
+		}
+	}
+	return out
+}
+
+func volumeList(binds []string, volumes, image map[string]struct{}) []string {
+	out := append([]string{}, binds...)
+	for v := range volumes {
+		if _, ok := image[v]; !ok {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// linkList normalizes docker's /other:/name/alias links to other:alias
+func linkList(links []string) []string {
+	out := make([]string, 0, len(links))
+	for _, l := range links {
+		parts := strings.SplitN(l, ":", 2)
+		name := strings.TrimPrefix(parts[0], "/")
+		alias := name
+		if len(parts) == 2 {
+			alias = parts[1][strings.LastIndex(parts[1], "/")+1:]
+		}
+		out = append(out, name+":"+alias)
+	}
+	return out
+}
+
+func restartPolicy(r engineRestartPolicy) string {
+	if r.Name == "" {
+		return "no"
+	}
+	if r.MaximumRetryCount > 0 {
+		return fmt.Sprintf("%v:%v", r.Name, r.MaximumRetryCount)
+	}
+	return r.Name
+}
+
+func networkMode(mode string) string {
+	if mode == "" || mode == "default" {
+		return "bridge"
+	}
+	return mode
+}
+
+// writeDiff prints diffs, - lines are found in the container, + lines in the config
+func writeDiff(out io.Writer, diffs []FieldDiff) {
+	for _, d := range diffs {
+		fmt.Fprintf(out, "%v\n", d.Field)
+		for _, v := range d.Have {
+			fmt.Fprintf(out, "  - %v\n", v)
+		}
+		for _, v := range d.Want {
+			fmt.Fprintf(out, "  + %v\n", v)
+		}
+	}
+}
+
+// diffContainer inspects the container of cmd and prints how it differs
+func diffContainer(ins inspector, cmd *Cmd) error {
+	name := cmd.Flags.Get("name")
+	container, err := ins.inspectContainer(name)
+	if err != nil {
+		return err
+	}
+	if container == nil {
+		return ErrNoContainer
+	}
+
+	haveImage, err := ins.inspectImage(container.Image)
+	if err != nil {
+		return err
+	}
+	wantImage, err := ins.inspectImage(cmd.Args[0])
+	if err != nil {
+		return err
+	}
+
+	diffs, err := configDiff(container, haveImage, cmd, wantImage)
+	if err != nil {
+		return err
+	}
+	if len(diffs) > 0 {
+		writeDiff(os.Stdout, diffs)
+		return ErrConfigDrift
+	}
+	return nil
+}
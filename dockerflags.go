@@ -6,9 +6,11 @@ import (
 	"github.com/mattes/go-collect/flags"
 )
 
-var DockerFlags = make(map[string]*flags.Flags)
+// DockerFlags are package vars, so commands can refer to them in init
+var DockerFlags = dockerFlags()
 
-func init() {
+func dockerFlags() map[string]*flags.Flags {
+	DockerFlags := make(map[string]*flags.Flags)
 
 	// Copy these values from
 	// https://github.com/docker/docker/tree/master/api/client
@@ -35,6 +37,7 @@ func init() {
 	DockerFlags["run"].Var([]string{"#link", "-link"}, "Add link to another container in the form of <name|id>:alias")
 	DockerFlags["run"].Var([]string{"-device"}, "Add a host device to the container (e.g. --device=/dev/sdc:/dev/xvdc:rwm)")
 
+	DockerFlags["run"].Var([]string{"l", "-label"}, "Set meta data on a container")
 	DockerFlags["run"].Var([]string{"e", "-env"}, "Set environment variables")
 	DockerFlags["run"].Var([]string{"-env-file"}, "Read in a line delimited file of environment variables")
 
@@ -82,6 +85,36 @@ func init() {
 	// Define DockerFlags["destroy"]
 	DockerFlags["destroy"] = flags.New("docker")
 
+	// Define DockerFlags["logs"]
+	DockerFlags["logs"] = flags.New("docker")
+	DockerFlags["logs"].Bool([]string{"f", "-follow"}, false, "Follow log output")
+	DockerFlags["logs"].Bool([]string{"t", "-timestamps"}, false, "Show timestamps")
+	DockerFlags["logs"].String([]string{"-tail"}, "all", "Output the specified number of lines at the end of logs (defaults to all logs)")
+	DockerFlags["logs"].String([]string{"-since"}, "", "Show logs since timestamp (e.g. 2015-06-01T12:00:00) or relative (e.g. 42m)")
+
+	// Define DockerFlags["start"]
+	DockerFlags["start"] = flags.New("docker")
+	DockerFlags["start"].Bool([]string{"a", "-attach"}, false, "Attach STDOUT/STDERR and forward signals")
+	DockerFlags["start"].Bool([]string{"i", "-interactive"}, false, "Attach container's STDIN")
+
+	// Define DockerFlags["stop"]
+	DockerFlags["stop"] = flags.New("docker")
+	DockerFlags["stop"].Int64([]string{"t", "-time"}, 10, "Number of seconds to wait for the container to stop before killing it")
+
+	// Define DockerFlags["restart"]
+	DockerFlags["restart"] = flags.New("docker")
+	DockerFlags["restart"].Int64([]string{"t", "-time"}, 10, "Number of seconds to try to stop for before killing the container. Once killed it will then be restarted.")
+
+	// Define DockerFlags["kill"]
+	DockerFlags["kill"] = flags.New("docker")
+	DockerFlags["kill"].String([]string{"s", "-signal"}, "KILL", "Signal to send to the container")
+
+	// Define DockerFlags["pause"]
+	DockerFlags["pause"] = flags.New("docker")
+
+	// Define DockerFlags["unpause"]
+	DockerFlags["unpause"] = flags.New("docker")
+
 	// Define DockerFlags["pull"]
 	DockerFlags["pull"] = flags.New("docker")
 	DockerFlags["pull"].Bool([]string{"a", "-all-tags"}, false, "Download all tagged images in the repository")
@@ -89,4 +122,29 @@ func init() {
 	// Define DockerFlags["push"]
 	DockerFlags["push"] = flags.New("docker")
 
+	// Define DockerFlags["up"], it runs docker build and docker run,
+	// build flags are long only, since -t is --tty for run
+	upBuild := flags.New("docker")
+	upBuild.String([]string{"-tag"}, "", "Tag for the image (!)")
+	upBuild.Bool([]string{"-no-cache"}, false, "Do not use cache when building the image")
+	upBuild.Bool([]string{"-force-rm"}, false, "Always remove intermediate containers")
+	upBuild.Bool([]string{"-pull"}, false, "Always attempt to pull a newer version of the image")
+	upBuild.String([]string{"-file"}, "", "Name of the Dockerfile (Default is 'PATH/Dockerfile')")
+	DockerFlags["up"] = flags.Merge(DockerFlags["run"], upBuild)
+	DockerFlags["up"].Name = "docker"
+
+	// Define DockerFlags["deploy"], it runs docker run
+	DockerFlags["deploy"] = flags.Merge(DockerFlags["run"])
+	DockerFlags["deploy"].Name = "docker"
+
+	// Define DockerFlags["diff"], it compares with docker run
+	DockerFlags["diff"] = flags.Merge(DockerFlags["run"])
+	DockerFlags["diff"].Name = "docker"
+
+	// Define DockerFlags["task"], it runs docker exec or docker run
+	DockerFlags["task"] = flags.New("docker")
+	DockerFlags["task"].Bool([]string{"i", "-interactive"}, false, "Keep STDIN open even if not attached")
+	DockerFlags["task"].Bool([]string{"t", "-tty"}, false, "Allocate a pseudo-TTY")
+
+	return DockerFlags
 }
@@ -0,0 +1,1070 @@
+package fugu
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/docker/docker/nat"
+	"github.com/docker/docker/opts"
+	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/docker/pkg/parsers"
+	"github.com/docker/docker/pkg/units"
+	"github.com/docker/docker/registry"
+	"github.com/docker/docker/utils"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDockerHost is used if DOCKER_HOST is not set
+const DefaultDockerHost = "unix:///var/run/docker.sock"
+
+var (
+	ErrEngineUnsupported = errors.New("not supported by the api backend")
+)
+
+// Engine runs docker commands against the Docker Engine API
+// instead of shelling out to the docker cli.
+type Engine struct {
+	Stdout io.Writer
+	Stderr io.Writer
+
+	client *http.Client
+	url    string
+}
+
+// EngineError is returned if the docker daemon answers with an error
+type EngineError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *EngineError) Error() string {
+	return fmt.Sprintf("engine: %v", e.Message)
+}
+
+// NewEngine returns an Engine talking to host, i.e. tcp://127.0.0.1:2375.
+// If host is empty, DOCKER_HOST or the default unix socket is used.
+func NewEngine(host string) (*Engine, error) {
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = DefaultDockerHost
+	}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("engine: %v", err.Error())
+	}
+
+	e := &Engine{
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		e.client = &http.Client{
+			Transport: &http.Transport{
+				Dial: func(network, addr string) (net.Conn, error) {
+					return net.Dial("unix", socket)
+				},
+			},
+		}
+		e.url = "http://docker"
+
+	case "tcp", "http", "https":
+		tlsConfig, err := engineTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		scheme := "http"
+		if tlsConfig != nil || u.Scheme == "https" {
+			scheme = "https"
+		}
+		e.client = &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: tlsConfig,
+			},
+		}
+		e.url = scheme + "://" + u.Host
+
+	default:
+		return nil, fmt.Errorf("engine: unsupported docker host %v", host)
+	}
+
+	return e, nil
+}
+
+// engineTLSConfig reads the client certificates like the docker cli does
+func engineTLSConfig() (*tls.Config, error) {
+	if os.Getenv("DOCKER_TLS_VERIFY") == "" {
+		return nil, nil
+	}
+
+	certPath := os.Getenv("DOCKER_CERT_PATH")
+	if certPath == "" {
+		certPath = expandTilde("~/.docker")
+	}
+
+	cert, err := tls.LoadX509KeyPair(filepath.Join(certPath, "cert.pem"), filepath.Join(certPath, "key.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("engine: %v", err.Error())
+	}
+
+	ca, err := ioutil.ReadFile(filepath.Join(certPath, "ca.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("engine: %v", err.Error())
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+	}, nil
+}
+
+// Exec runs cmd against the docker daemon
+// It returns an *ExitError if the container exits with a non-zero status.
+func (e *Engine) Exec(cmd *Cmd) error {
+	switch cmd.Command {
+	case "build":
+		return e.build(cmd)
+	case "run":
+		return e.run(cmd)
+	case "exec":
+		return e.exec(cmd)
+	case "rm":
+		return e.rm(cmd)
+	case "logs":
+		return e.logs(cmd)
+	case "start", "stop", "restart", "kill", "pause", "unpause":
+		return e.lifecycle(cmd)
+	case "rename":
+		return e.rename(cmd)
+	case "push":
+		return e.push(cmd)
+	case "pull":
+		return e.pull(cmd)
+	}
+	return fmt.Errorf("engine: docker %v is %v", cmd.Command, ErrEngineUnsupported)
+}
+
+func (e *Engine) build(cmd *Cmd) error {
+	if err := checkEngineFlags(cmd, "tag", "quiet", "no-cache", "rm", "force-rm", "pull", "file"); err != nil {
+		return err
+	}
+	if len(cmd.Args) != 1 {
+		return ErrTooManyArgs
+	}
+
+	p := cmd.Flags
+	query := url.Values{}
+	query.Set("t", p.Get("tag"))
+	query.Set("dockerfile", p.Get("file"))
+	query.Set("q", engineBool(p.IsTrue("quiet")))
+	query.Set("nocache", engineBool(p.IsTrue("no-cache")))
+	query.Set("rm", engineBool(!p.IsFalse("rm")))
+	query.Set("forcerm", engineBool(p.IsTrue("force-rm")))
+	query.Set("pull", engineBool(p.IsTrue("pull")))
+
+	var body io.Reader
+	context := cmd.Args[0]
+	if isRemoteContext(context) {
+		query.Set("remote", context)
+	} else {
+		excludes, err := utils.ReadDockerIgnore(filepath.Join(context, ".dockerignore"))
+		if err != nil {
+			return fmt.Errorf("engine: %v", err.Error())
+		}
+		tar, err := archive.TarWithOptions(context, &archive.TarOptions{
+			Compression:     archive.Uncompressed,
+			ExcludePatterns: excludes,
+		})
+		if err != nil {
+			return fmt.Errorf("engine: %v", err.Error())
+		}
+		defer tar.Close()
+		body = tar
+	}
+
+	req, err := e.newRequest("POST", "/build", query, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-tar")
+
+	resp, err := e.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return e.jsonStream(resp.Body)
+}
+
+func (e *Engine) run(cmd *Cmd) error {
+	if err := checkEngineFlags(cmd, engineRunFlags...); err != nil {
+		return err
+	}
+	if len(cmd.Args) < 1 {
+		return ErrMissingImage
+	}
+
+	p := cmd.Flags
+	if p.IsTrue("interactive") {
+		return fmt.Errorf("engine: run: --interactive is %v", ErrEngineUnsupported)
+	}
+	if p.IsTrue("detach") && p.IsTrue("rm") {
+		return fmt.Errorf("engine: run: conflicting options --rm and --detach")
+	}
+
+	config, err := engineContainerConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	id, err := e.create(p.Get("name"), config)
+	if engineErr, ok := err.(*EngineError); ok && engineErr.StatusCode == http.StatusNotFound {
+		// pull missing image like the docker cli does
+		repo, tag := parsers.ParseRepositoryTag(config.Image)
+		if tag == "" {
+			tag = "latest"
+		}
+		if err := e.pullImage(repo, tag); err != nil {
+			return err
+		}
+		id, err = e.create(p.Get("name"), config)
+	}
+	if err != nil {
+		return err
+	}
+
+	if cidfile := p.Get("cidfile"); cidfile != "" {
+		if err := ioutil.WriteFile(cidfile, []byte(id), 0644); err != nil {
+			return fmt.Errorf("engine: %v", err.Error())
+		}
+	}
+
+	if p.IsTrue("detach") {
+		if err := e.start(id); err != nil {
+			return err
+		}
+		fmt.Fprintln(e.Stdout, id)
+		return nil
+	}
+
+	// attach before starting the container, so we don't miss any output
+	query := url.Values{}
+	query.Set("stream", "1")
+	query.Set("stdout", engineBool(config.AttachStdout))
+	query.Set("stderr", engineBool(config.AttachStderr))
+	req, err := e.newRequest("POST", "/containers/"+id+"/attach", query, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := e.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := e.start(id); err != nil {
+		return err
+	}
+
+	if err := e.copyStream(resp.Body, config.Tty); err != nil {
+		return err
+	}
+
+	var status struct {
+		StatusCode int
+	}
+	req, err = e.newRequest("POST", "/containers/"+id+"/wait", nil, nil)
+	if err != nil {
+		return err
+	}
+	if err := e.doJSON(req, &status); err != nil {
+		return err
+	}
+
+	if p.IsTrue("rm") {
+		query := url.Values{}
+		query.Set("v", "1")
+		req, err := e.newRequest("DELETE", "/containers/"+id, query, nil)
+		if err != nil {
+			return err
+		}
+		if err := e.doJSON(req, nil); err != nil {
+			return err
+		}
+	}
+
+	if status.StatusCode != 0 {
+		return &ExitError{Code: status.StatusCode}
+	}
+	return nil
+}
+
+func (e *Engine) create(name string, config *engineConfig) (id string, err error) {
+	query := url.Values{}
+	if name != "" {
+		query.Set("name", name)
+	}
+	req, err := e.newRequest("POST", "/containers/create", query, config)
+	if err != nil {
+		return "", err
+	}
+
+	var created struct {
+		Id string
+	}
+	if err := e.doJSON(req, &created); err != nil {
+		return "", err
+	}
+	return created.Id, nil
+}
+
+func (e *Engine) start(id string) error {
+	req, err := e.newRequest("POST", "/containers/"+id+"/start", nil, nil)
+	if err != nil {
+		return err
+	}
+	return e.doJSON(req, nil)
+}
+
+func (e *Engine) exec(cmd *Cmd) error {
+	if err := checkEngineFlags(cmd, "interactive", "tty", "detach"); err != nil {
+		return err
+	}
+	if len(cmd.Args) < 1 {
+		return ErrMissingName
+	}
+	if len(cmd.Args) < 2 {
+		return fmt.Errorf("engine: exec: no command given")
+	}
+
+	p := cmd.Flags
+	if p.IsTrue("interactive") {
+		return fmt.Errorf("engine: exec: --interactive is %v", ErrEngineUnsupported)
+	}
+
+	detach := p.IsTrue("detach")
+	tty := p.IsTrue("tty")
+
+	config := map[string]interface{}{
+		"AttachStdout": !detach,
+		"AttachStderr": !detach,
+		"Tty":          tty,
+		"Cmd":          cmd.Args[1:],
+	}
+	req, err := e.newRequest("POST", "/containers/"+cmd.Args[0]+"/exec", nil, config)
+	if err != nil {
+		return err
+	}
+	var created struct {
+		Id string
+	}
+	if err := e.doJSON(req, &created); err != nil {
+		return err
+	}
+
+	start := map[string]interface{}{
+		"Detach": detach,
+		"Tty":    tty,
+	}
+	req, err = e.newRequest("POST", "/exec/"+created.Id+"/start", nil, start)
+	if err != nil {
+		return err
+	}
+	resp, err := e.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if detach {
+		return nil
+	}
+
+	if err := e.copyStream(resp.Body, tty); err != nil {
+		return err
+	}
+
+	var inspect struct {
+		ExitCode int
+	}
+	req, err = e.newRequest("GET", "/exec/"+created.Id+"/json", nil, nil)
+	if err != nil {
+		return err
+	}
+	if err := e.doJSON(req, &inspect); err != nil {
+		return err
+	}
+	if inspect.ExitCode != 0 {
+		return &ExitError{Code: inspect.ExitCode}
+	}
+	return nil
+}
+
+func (e *Engine) rm(cmd *Cmd) error {
+	if err := checkEngineFlags(cmd, "force"); err != nil {
+		return err
+	}
+	if len(cmd.Args) < 1 {
+		return ErrMissingName
+	}
+
+	for _, name := range cmd.Args {
+		query := url.Values{}
+		query.Set("force", engineBool(cmd.Flags.IsTrue("force")))
+		req, err := e.newRequest("DELETE", "/containers/"+name, query, nil)
+		if err != nil {
+			return err
+		}
+		if err := e.doJSON(req, nil); err != nil {
+			return err
+		}
+		fmt.Fprintln(e.Stdout, name)
+	}
+	return nil
+}
+
+// lifecycle posts start, stop, restart, kill, pause and unpause
+func (e *Engine) lifecycle(cmd *Cmd) error {
+	query := url.Values{}
+	switch cmd.Command {
+	case "start":
+		if cmd.Flags.IsTrue("attach") || cmd.Flags.IsTrue("interactive") {
+			return ErrEngineUnsupported
+		}
+		if err := checkEngineFlags(cmd, "attach", "interactive"); err != nil {
+			return err
+		}
+	case "stop", "restart":
+		if err := checkEngineFlags(cmd, "time"); err != nil {
+			return err
+		}
+		if t := cmd.Flags.Get("time"); t != "" {
+			query.Set("t", t)
+		}
+	case "kill":
+		if err := checkEngineFlags(cmd, "signal"); err != nil {
+			return err
+		}
+		if signal := cmd.Flags.Get("signal"); signal != "" {
+			query.Set("signal", signal)
+		}
+	default:
+		if err := checkEngineFlags(cmd); err != nil {
+			return err
+		}
+	}
+	if len(cmd.Args) < 1 {
+		return ErrMissingName
+	}
+
+	for _, name := range cmd.Args {
+		req, err := e.newRequest("POST", "/containers/"+name+"/"+cmd.Command, query, nil)
+		if err != nil {
+			return err
+		}
+		if err := e.doJSON(req, nil); err != nil {
+			return err
+		}
+		fmt.Fprintln(e.Stdout, name)
+	}
+	return nil
+}
+
+func (e *Engine) rename(cmd *Cmd) error {
+	if err := checkEngineFlags(cmd); err != nil {
+		return err
+	}
+	if len(cmd.Args) != 2 {
+		return ErrMissingName
+	}
+
+	query := url.Values{}
+	query.Set("name", cmd.Args[1])
+	req, err := e.newRequest("POST", "/containers/"+cmd.Args[0]+"/rename", query, nil)
+	if err != nil {
+		return err
+	}
+	return e.doJSON(req, nil)
+}
+
+func (e *Engine) logs(cmd *Cmd) error {
+	if err := checkEngineFlags(cmd, "follow", "timestamps", "tail", "since"); err != nil {
+		return err
+	}
+	if len(cmd.Args) != 1 {
+		return ErrMissingName
+	}
+
+	p := cmd.Flags
+	query := url.Values{}
+	query.Set("stdout", "1")
+	query.Set("stderr", "1")
+	query.Set("follow", engineBool(p.IsTrue("follow")))
+	query.Set("timestamps", engineBool(p.IsTrue("timestamps")))
+	if tail := p.Get("tail"); tail != "" {
+		query.Set("tail", tail)
+	}
+	if since := p.Get("since"); since != "" {
+		ts, err := engineTimestamp(since, time.Now())
+		if err != nil {
+			return err
+		}
+		query.Set("since", ts)
+	}
+
+	// logs of containers with a tty are not multiplexed
+	var container struct {
+		Config struct {
+			Tty bool
+		}
+	}
+	req, err := e.newRequest("GET", "/containers/"+cmd.Args[0]+"/json", nil, nil)
+	if err != nil {
+		return err
+	}
+	if err := e.doJSON(req, &container); err != nil {
+		return err
+	}
+
+	req, err = e.newRequest("GET", "/containers/"+cmd.Args[0]+"/logs", query, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := e.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return e.copyStream(resp.Body, container.Config.Tty)
+}
+
+func (e *Engine) push(cmd *Cmd) error {
+	if err := checkEngineFlags(cmd); err != nil {
+		return err
+	}
+	if len(cmd.Args) != 1 {
+		return ErrMissingImage
+	}
+
+	repo, tag := parsers.ParseRepositoryTag(cmd.Args[0])
+	query := url.Values{}
+	query.Set("tag", tag)
+	req, err := e.newRequest("POST", "/images/"+repo+"/push", query, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Registry-Auth", registryAuth(repo))
+
+	resp, err := e.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return e.jsonStream(resp.Body)
+}
+
+func (e *Engine) pull(cmd *Cmd) error {
+	if err := checkEngineFlags(cmd, "all-tags"); err != nil {
+		return err
+	}
+	if len(cmd.Args) != 1 {
+		return ErrMissingImage
+	}
+
+	repo, tag := parsers.ParseRepositoryTag(cmd.Args[0])
+	if tag == "" && !cmd.Flags.IsTrue("all-tags") {
+		tag = "latest"
+	}
+	return e.pullImage(repo, tag)
+}
+
+func (e *Engine) pullImage(repo, tag string) error {
+	query := url.Values{}
+	query.Set("fromImage", repo)
+	if tag != "" {
+		query.Set("tag", tag)
+	}
+	req, err := e.newRequest("POST", "/images/create", query, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Registry-Auth", registryAuth(repo))
+
+	resp, err := e.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return e.jsonStream(resp.Body)
+}
+
+// newRequest creates a request for the docker daemon
+// body is either nil, an io.Reader or encoded as json
+func (e *Engine) newRequest(method, path string, query url.Values, body interface{}) (*http.Request, error) {
+	var r io.Reader
+	contentType := ""
+	switch b := body.(type) {
+	case nil:
+	case io.Reader:
+		r = b
+	default:
+		buf, err := json.Marshal(b)
+		if err != nil {
+			return nil, fmt.Errorf("engine: %v", err.Error())
+		}
+		r = strings.NewReader(string(buf))
+		contentType = "application/json"
+	}
+
+	u := e.url + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, r)
+	if err != nil {
+		return nil, fmt.Errorf("engine: %v", err.Error())
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return req, nil
+}
+
+// do sends the request and returns an *EngineError for non-2xx responses
+func (e *Engine) do(req *http.Request) (*http.Response, error) {
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("engine: %v", err.Error())
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		var msg struct {
+			Message string `json:"message"`
+		}
+		message := strings.TrimSpace(string(body))
+		if err := json.Unmarshal(body, &msg); err == nil && msg.Message != "" {
+			message = msg.Message
+		}
+		if message == "" {
+			message = http.StatusText(resp.StatusCode)
+		}
+		return nil, &EngineError{StatusCode: resp.StatusCode, Message: message}
+	}
+
+	return resp, nil
+}
+
+// doJSON sends the request and decodes the response into v
+func (e *Engine) doJSON(req *http.Request, v interface{}) error {
+	resp, err := e.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if v == nil {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("engine: %v", err.Error())
+	}
+	return nil
+}
+
+// jsonStream prints the progress messages of build, push and pull
+func (e *Engine) jsonStream(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	for {
+		var m struct {
+			Stream      string `json:"stream"`
+			Status      string `json:"status"`
+			Progress    string `json:"progress"`
+			ID          string `json:"id"`
+			Error       string `json:"error"`
+			ErrorDetail struct {
+				Message string `json:"message"`
+			} `json:"errorDetail"`
+		}
+		if err := dec.Decode(&m); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("engine: %v", err.Error())
+		}
+
+		if m.ErrorDetail.Message != "" {
+			return &EngineError{Message: m.ErrorDetail.Message}
+		}
+		if m.Error != "" {
+			return &EngineError{Message: m.Error}
+		}
+
+		if m.Stream != "" {
+			fmt.Fprint(e.Stdout, m.Stream)
+		} else if m.Status != "" {
+			line := m.Status
+			if m.ID != "" {
+				line = m.ID + ": " + line
+			}
+			if m.Progress != "" {
+				line += " " + m.Progress
+			}
+			fmt.Fprintln(e.Stdout, line)
+		}
+	}
+}
+
+// copyStream copies container output to Stdout and Stderr.
+// Without a tty docker multiplexes both streams into one.
+func (e *Engine) copyStream(r io.Reader, tty bool) error {
+	if tty {
+		_, err := io.Copy(e.Stdout, r)
+		return err
+	}
+	return demuxStream(r, e.Stdout, e.Stderr)
+}
+
+// demuxStream splits a multiplexed docker stream. Each frame has a
+// 8 byte header: [stream type, 0, 0, 0, size (4 bytes, big endian)].
+func demuxStream(r io.Reader, stdout, stderr io.Writer) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("engine: %v", err.Error())
+		}
+
+		size := int64(header[4])<<24 | int64(header[5])<<16 | int64(header[6])<<8 | int64(header[7])
+		w := stdout
+		if header[0] == 2 {
+			w = stderr
+		}
+		if _, err := io.CopyN(w, r, size); err != nil {
+			return fmt.Errorf("engine: %v", err.Error())
+		}
+	}
+}
+
+// engineRunFlags are the DockerFlags["run"] the api backend understands
+var engineRunFlags = []string{
+	"rm", "detach", "sig-proxy", "name", "attach", "volume", "link", "device",
+	"env", "env-file", "label", "publish", "expose", "dns", "dns-search", "add-host",
+	"volumes-from", "cap-add", "cap-drop", "security-opt", "privileged", "pid",
+	"publish-all", "interactive", "tty", "cidfile", "entrypoint", "hostname",
+	"memory", "memory-swap", "user", "workdir", "cpu-shares", "cpuset", "net",
+	"mac-address", "ipc", "restart", "read-only", "log-driver", "log-opt",
+}
+
+type engineConfig struct {
+	Hostname     string                `json:",omitempty"`
+	User         string                `json:",omitempty"`
+	AttachStdout bool                  `json:",omitempty"`
+	AttachStderr bool                  `json:",omitempty"`
+	Tty          bool                  `json:",omitempty"`
+	ExposedPorts map[nat.Port]struct{} `json:",omitempty"`
+	Env          []string              `json:",omitempty"`
+	Cmd          []string              `json:",omitempty"`
+	Entrypoint   []string              `json:",omitempty"`
+	Image        string
+	Volumes      map[string]struct{} `json:",omitempty"`
+	WorkingDir   string              `json:",omitempty"`
+	MacAddress   string              `json:",omitempty"`
+	Labels       map[string]string   `json:",omitempty"`
+	HostConfig   engineHostConfig
+}
+
+type engineHostConfig struct {
+	Binds           []string            `json:",omitempty"`
+	Links           []string            `json:",omitempty"`
+	PortBindings    nat.PortMap         `json:",omitempty"`
+	PublishAllPorts bool                `json:",omitempty"`
+	Privileged      bool                `json:",omitempty"`
+	ReadonlyRootfs  bool                `json:",omitempty"`
+	Dns             []string            `json:",omitempty"`
+	DnsSearch       []string            `json:",omitempty"`
+	ExtraHosts      []string            `json:",omitempty"`
+	VolumesFrom     []string            `json:",omitempty"`
+	CapAdd          []string            `json:",omitempty"`
+	CapDrop         []string            `json:",omitempty"`
+	SecurityOpt     []string            `json:",omitempty"`
+	Devices         []engineDevice      `json:",omitempty"`
+	NetworkMode     string              `json:",omitempty"`
+	PidMode         string              `json:",omitempty"`
+	IpcMode         string              `json:",omitempty"`
+	RestartPolicy   engineRestartPolicy `json:",omitempty"`
+	Memory          int64               `json:",omitempty"`
+	MemorySwap      int64               `json:",omitempty"`
+	CpuShares       int64               `json:",omitempty"`
+	CpusetCpus      string              `json:",omitempty"`
+	LogConfig       engineLogConfig     `json:",omitempty"`
+}
+
+type engineDevice struct {
+	PathOnHost        string
+	PathInContainer   string
+	CgroupPermissions string
+}
+
+type engineRestartPolicy struct {
+	Name              string `json:",omitempty"`
+	MaximumRetryCount int    `json:",omitempty"`
+}
+
+type engineLogConfig struct {
+	Type   string            `json:",omitempty"`
+	Config map[string]string `json:",omitempty"`
+}
+
+// engineContainerConfig maps the docker run flags to the
+// body of a container create request
+func engineContainerConfig(cmd *Cmd) (*engineConfig, error) {
+	p := cmd.Flags
+	config := &engineConfig{
+		Hostname:     p.Get("hostname"),
+		User:         p.Get("user"),
+		Tty:          p.IsTrue("tty"),
+		Image:        cmd.Args[0],
+		Cmd:          cmd.Args[1:],
+		WorkingDir:   p.Get("workdir"),
+		MacAddress:   p.Get("mac-address"),
+		AttachStdout: !p.IsTrue("detach"),
+		AttachStderr: !p.IsTrue("detach"),
+	}
+	hc := &config.HostConfig
+
+	if attach := p.GetAll("attach"); len(attach) > 0 && !p.IsTrue("detach") {
+		config.AttachStdout, config.AttachStderr = false, false
+		for _, a := range attach {
+			switch strings.ToLower(a) {
+			case "stdout":
+				config.AttachStdout = true
+			case "stderr":
+				config.AttachStderr = true
+			default:
+				return nil, fmt.Errorf("engine: run: --attach=%v is %v", a, ErrEngineUnsupported)
+			}
+		}
+	}
+
+	if entrypoint := p.Get("entrypoint"); entrypoint != "" {
+		config.Entrypoint = []string{entrypoint}
+	}
+
+	for _, f := range p.GetAll("env-file") {
+		env, err := opts.ParseEnvFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("engine: %v", err.Error())
+		}
+		config.Env = append(config.Env, env...)
+	}
+	config.Env = append(config.Env, p.GetAll("env")...)
+
+	for _, l := range p.GetAll("label") {
+		if config.Labels == nil {
+			config.Labels = make(map[string]string)
+		}
+		kv := strings.SplitN(l, "=", 2)
+		if len(kv) == 2 {
+			config.Labels[kv[0]] = kv[1]
+		} else {
+			config.Labels[kv[0]] = ""
+		}
+	}
+
+	exposed, bindings, err := nat.ParsePortSpecs(p.GetAll("publish"))
+	if err != nil {
+		return nil, fmt.Errorf("engine: %v", err.Error())
+	}
+	for _, e := range p.GetAll("expose") {
+		proto, port := nat.SplitProtoPort(e)
+		exposed[nat.NewPort(proto, port)] = struct{}{}
+	}
+	if len(exposed) > 0 {
+		config.ExposedPorts = exposed
+	}
+	if len(bindings) > 0 {
+		hc.PortBindings = bindings
+	}
+
+	for _, v := range p.GetAll("volume") {
+		if strings.Contains(v, ":") {
+			hc.Binds = append(hc.Binds, v)
+		} else {
+			if config.Volumes == nil {
+				config.Volumes = make(map[string]struct{})
+			}
+			config.Volumes[v] = struct{}{}
+		}
+	}
+
+	for _, d := range p.GetAll("device") {
+		parts := strings.Split(d, ":")
+		device := engineDevice{PathOnHost: parts[0], PathInContainer: parts[0], CgroupPermissions: "rwm"}
+		if len(parts) > 1 {
+			device.PathInContainer = parts[1]
+		}
+		if len(parts) > 2 {
+			device.CgroupPermissions = parts[2]
+		}
+		hc.Devices = append(hc.Devices, device)
+	}
+
+	if restart := p.Get("restart"); restart != "" {
+		parts := strings.SplitN(restart, ":", 2)
+		hc.RestartPolicy.Name = parts[0]
+		if len(parts) == 2 {
+			count, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("engine: invalid restart policy %v", restart)
+			}
+			hc.RestartPolicy.MaximumRetryCount = count
+		}
+	}
+
+	if memory := p.Get("memory"); memory != "" {
+		if hc.Memory, err = units.RAMInBytes(memory); err != nil {
+			return nil, fmt.Errorf("engine: %v", err.Error())
+		}
+	}
+	if swap := p.Get("memory-swap"); swap == "-1" {
+		hc.MemorySwap = -1
+	} else if swap != "" {
+		if hc.MemorySwap, err = units.RAMInBytes(swap); err != nil {
+			return nil, fmt.Errorf("engine: %v", err.Error())
+		}
+	}
+	if shares := p.Get("cpu-shares"); shares != "" {
+		if hc.CpuShares, err = strconv.ParseInt(shares, 10, 64); err != nil {
+			return nil, fmt.Errorf("engine: %v", err.Error())
+		}
+	}
+
+	if driver := p.Get("log-driver"); driver != "" {
+		hc.LogConfig.Type = driver
+	}
+	for _, o := range p.GetAll("log-opt") {
+		kv := strings.SplitN(o, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("engine: invalid log-opt %v", o)
+		}
+		if hc.LogConfig.Config == nil {
+			hc.LogConfig.Config = make(map[string]string)
+		}
+		hc.LogConfig.Config[kv[0]] = kv[1]
+	}
+
+	hc.Links = p.GetAll("link")
+	hc.PublishAllPorts = p.IsTrue("publish-all")
+	hc.Privileged = p.IsTrue("privileged")
+	hc.ReadonlyRootfs = p.IsTrue("read-only")
+	hc.Dns = p.GetAll("dns")
+	hc.DnsSearch = p.GetAll("dns-search")
+	hc.ExtraHosts = p.GetAll("add-host")
+	hc.VolumesFrom = p.GetAll("volumes-from")
+	hc.CapAdd = p.GetAll("cap-add")
+	hc.CapDrop = p.GetAll("cap-drop")
+	hc.SecurityOpt = p.GetAll("security-opt")
+	hc.NetworkMode = p.Get("net")
+	hc.PidMode = p.Get("pid")
+	hc.IpcMode = p.Get("ipc")
+	hc.CpusetCpus = p.Get("cpuset")
+
+	return config, nil
+}
+
+// checkEngineFlags returns an error for flags the api backend can't handle
+func checkEngineFlags(cmd *Cmd, supported ...string) error {
+	if cmd.Flags == nil {
+		return nil
+	}
+	keys := cmd.Flags.Keys()
+	sort.Sort(sort.StringSlice(keys))
+	for _, k := range keys {
+		ok := false
+		for _, s := range supported {
+			if k == s {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("engine: %v: --%v is %v", cmd.Command, k, ErrEngineUnsupported)
+		}
+	}
+	return nil
+}
+
+// registryAuth returns the X-Registry-Auth header for repo
+// with credentials from ~/.dockercfg
+func registryAuth(repo string) string {
+	auth := registry.AuthConfig{}
+	if config, err := registry.LoadConfig(expandTilde("~")); err == nil {
+		if info, err := registry.ParseRepositoryInfo(repo); err == nil {
+			auth = config.ResolveAuthConfig(info.Index)
+		}
+	}
+	buf, _ := json.Marshal(auth)
+	return base64.URLEncoding.EncodeToString(buf)
+}
+
+func isRemoteContext(context string) bool {
+	for _, prefix := range []string{"http://", "https://", "git://", "git@", "github.com/"} {
+		if strings.HasPrefix(context, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// engineTimestamp converts a timestamp or a duration relative
+// to now into unix time, i.e. 2015-06-01T12:00:00 or 42m
+func engineTimestamp(value string, now time.Time) (string, error) {
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return value, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return strconv.FormatInt(now.Add(-d).Unix(), 10), nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return strconv.FormatInt(t.Unix(), 10), nil
+		}
+	}
+	return "", fmt.Errorf("engine: invalid timestamp %v", value)
+}
+
+func engineBool(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
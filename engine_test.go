@@ -0,0 +1,429 @@
+package fugu
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"github.com/mattes/go-collect"
+	"github.com/mattes/go-collect/data"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDaemon is a minimal docker daemon recording all requests
+type fakeDaemon struct {
+	mu       sync.Mutex
+	requests []fakeRequest
+
+	// handlers by "METHOD /path", default is 200 with {}
+	handlers map[string]http.HandlerFunc
+}
+
+type fakeRequest struct {
+	Method string
+	Path   string
+	Query  map[string][]string
+	Body   []byte
+}
+
+func newFakeDaemon() *fakeDaemon {
+	return &fakeDaemon{handlers: make(map[string]http.HandlerFunc)}
+}
+
+func (d *fakeDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	d.mu.Lock()
+	d.requests = append(d.requests, fakeRequest{r.Method, r.URL.Path, r.URL.Query(), body})
+	h, ok := d.handlers[r.Method+" "+r.URL.Path]
+	d.mu.Unlock()
+
+	if ok {
+		h(w, r)
+		return
+	}
+	w.Write([]byte("{}"))
+}
+
+// request returns the last request for "METHOD /path"
+func (d *fakeDaemon) request(route string) *fakeRequest {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := len(d.requests) - 1; i >= 0; i-- {
+		if d.requests[i].Method+" "+d.requests[i].Path == route {
+			return &d.requests[i]
+		}
+	}
+	return nil
+}
+
+func (d *fakeDaemon) json(route string, v interface{}) {
+	d.handlers[route] = func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(v)
+	}
+}
+
+func newTestEngine(t *testing.T, d *fakeDaemon) (*Engine, *bytes.Buffer, *bytes.Buffer, func()) {
+	srv := httptest.NewServer(d)
+	e, err := NewEngine("tcp://" + strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	e.Stdout, e.Stderr = stdout, stderr
+	return e, stdout, stderr, srv.Close
+}
+
+func testCmd(t *testing.T, command string, args ...string) *Cmd {
+	c := collect.New()
+	data, remainingArgs, err := c.Parse(args, FuguFlags[command], DockerFlags[command])
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := Lookup(command).Docker(c, data, remainingArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cmd
+}
+
+// frame returns a multiplexed stream frame
+func frame(stream byte, payload string) []byte {
+	n := len(payload)
+	return append([]byte{stream, 0, 0, 0, byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}, payload...)
+}
+
+func TestEngineRunDetached(t *testing.T) {
+	d := newFakeDaemon()
+	d.json("POST /containers/create", map[string]string{"Id": "abc123"})
+	e, stdout, _, done := newTestEngine(t, d)
+	defer done()
+
+	cmd := testCmd(t, "run", "--image=redis", "--name=my-redis", "--detach",
+		"--env=A=b", "--publish=8080:80", "--volume=/tmp:/data", "--volume=/cache",
+		"--restart=on-failure:3", "--memory=1g", "server", "--port")
+
+	assert.NoError(t, e.Exec(cmd))
+	assert.Equal(t, "abc123\n", stdout.String())
+
+	create := d.request("POST /containers/create")
+	if assert.NotNil(t, create) {
+		assert.Equal(t, []string{"my-redis"}, create.Query["name"])
+
+		var config engineConfig
+		assert.NoError(t, json.Unmarshal(create.Body, &config))
+		assert.Equal(t, "redis", config.Image)
+		assert.Equal(t, []string{"server", "--port"}, config.Cmd)
+		assert.Equal(t, []string{"A=b"}, config.Env)
+		assert.False(t, config.AttachStdout)
+		_, exposed := config.ExposedPorts["80/tcp"]
+		assert.True(t, exposed)
+		assert.Equal(t, "8080", config.HostConfig.PortBindings["80/tcp"][0].HostPort)
+		assert.Equal(t, []string{"/tmp:/data"}, config.HostConfig.Binds)
+		_, volume := config.Volumes["/cache"]
+		assert.True(t, volume)
+		assert.Equal(t, engineRestartPolicy{"on-failure", 3}, config.HostConfig.RestartPolicy)
+		assert.Equal(t, int64(1024*1024*1024), config.HostConfig.Memory)
+	}
+
+	assert.NotNil(t, d.request("POST /containers/abc123/start"))
+	assert.Nil(t, d.request("POST /containers/abc123/attach"))
+}
+
+func TestEngineRunAttached(t *testing.T) {
+	d := newFakeDaemon()
+	d.json("POST /containers/create", map[string]string{"Id": "abc123"})
+	d.handlers["POST /containers/abc123/attach"] = func(w http.ResponseWriter, r *http.Request) {
+		w.Write(frame(1, "hello\n"))
+		w.Write(frame(2, "oops\n"))
+	}
+	d.json("POST /containers/abc123/wait", map[string]int{"StatusCode": 3})
+	e, stdout, stderr, done := newTestEngine(t, d)
+	defer done()
+
+	err := e.Exec(testCmd(t, "run", "--image=redis", "--rm"))
+	assert.Equal(t, &ExitError{Code: 3}, err)
+	assert.Equal(t, "hello\n", stdout.String())
+	assert.Equal(t, "oops\n", stderr.String())
+
+	assert.NotNil(t, d.request("POST /containers/abc123/start"))
+	assert.NotNil(t, d.request("DELETE /containers/abc123"))
+}
+
+func TestEngineRunPullsMissingImage(t *testing.T) {
+	d := newFakeDaemon()
+	created := false
+	d.handlers["POST /containers/create"] = func(w http.ResponseWriter, r *http.Request) {
+		if !created {
+			created = true
+			http.Error(w, `{"message": "No such image: redis"}`, http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"Id": "abc123"}`))
+	}
+	d.json("POST /images/create", map[string]string{"status": "Downloaded newer image for redis:latest"})
+	e, stdout, _, done := newTestEngine(t, d)
+	defer done()
+
+	assert.NoError(t, e.Exec(testCmd(t, "run", "--image=redis", "--detach")))
+	assert.Contains(t, stdout.String(), "Downloaded newer image")
+
+	pull := d.request("POST /images/create")
+	if assert.NotNil(t, pull) {
+		assert.Equal(t, []string{"redis"}, pull.Query["fromImage"])
+		assert.Equal(t, []string{"latest"}, pull.Query["tag"])
+	}
+}
+
+func TestEngineRunUnsupported(t *testing.T) {
+	d := newFakeDaemon()
+	e, _, _, done := newTestEngine(t, d)
+	defer done()
+
+	err := e.Exec(testCmd(t, "run", "--image=redis", "--lxc-conf=lxc.foo=bar"))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "--lxc-conf is "+ErrEngineUnsupported.Error())
+	}
+
+	err = e.Exec(testCmd(t, "run", "--image=redis", "--interactive"))
+	assert.Error(t, err)
+
+	assert.Nil(t, d.request("POST /containers/create"))
+}
+
+func TestEngineExec(t *testing.T) {
+	d := newFakeDaemon()
+	d.json("POST /containers/my-redis/exec", map[string]string{"Id": "exec1"})
+	d.handlers["POST /exec/exec1/start"] = func(w http.ResponseWriter, r *http.Request) {
+		w.Write(frame(1, "PONG\n"))
+	}
+	d.json("GET /exec/exec1/json", map[string]int{"ExitCode": 0})
+	e, stdout, _, done := newTestEngine(t, d)
+	defer done()
+
+	assert.NoError(t, e.Exec(testCmd(t, "exec", "--name=my-redis", "redis-cli", "ping")))
+	assert.Equal(t, "PONG\n", stdout.String())
+
+	create := d.request("POST /containers/my-redis/exec")
+	if assert.NotNil(t, create) {
+		var config struct {
+			Cmd []string
+		}
+		assert.NoError(t, json.Unmarshal(create.Body, &config))
+		assert.Equal(t, []string{"redis-cli", "ping"}, config.Cmd)
+	}
+}
+
+func TestEngineRm(t *testing.T) {
+	d := newFakeDaemon()
+	d.handlers["DELETE /containers/missing"] = func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no such id: missing", http.StatusNotFound)
+	}
+	e, stdout, _, done := newTestEngine(t, d)
+	defer done()
+
+	assert.NoError(t, e.Exec(testCmd(t, "destroy", "--name=my-redis")))
+	assert.Equal(t, "my-redis\n", stdout.String())
+	rm := d.request("DELETE /containers/my-redis")
+	if assert.NotNil(t, rm) {
+		assert.Equal(t, []string{"1"}, rm.Query["force"])
+	}
+
+	err := e.Exec(testCmd(t, "destroy", "--name=missing"))
+	assert.Equal(t, &EngineError{StatusCode: 404, Message: "no such id: missing"}, err)
+}
+
+func TestEngineLifecycle(t *testing.T) {
+	d := newFakeDaemon()
+	e, stdout, _, done := newTestEngine(t, d)
+	defer done()
+
+	assert.NoError(t, e.Exec(testCmd(t, "stop", "--name=my-redis", "--time=3")))
+	stop := d.request("POST /containers/my-redis/stop")
+	if assert.NotNil(t, stop) {
+		assert.Equal(t, []string{"3"}, stop.Query["t"])
+	}
+
+	assert.NoError(t, e.Exec(testCmd(t, "kill", "--name=my-redis", "--signal=HUP")))
+	kill := d.request("POST /containers/my-redis/kill")
+	if assert.NotNil(t, kill) {
+		assert.Equal(t, []string{"HUP"}, kill.Query["signal"])
+	}
+
+	assert.NoError(t, e.Exec(testCmd(t, "pause", "--name=my-redis")))
+	assert.NotNil(t, d.request("POST /containers/my-redis/pause"))
+	assert.Equal(t, "my-redis\nmy-redis\nmy-redis\n", stdout.String())
+
+	assert.Equal(t, ErrEngineUnsupported, e.Exec(testCmd(t, "start", "--name=my-redis", "--attach")))
+
+	assert.NoError(t, e.Exec(&Cmd{Command: "rename", Flags: data.New(), Args: []string{"my-redis-fugu-next", "my-redis"}}))
+	rename := d.request("POST /containers/my-redis-fugu-next/rename")
+	if assert.NotNil(t, rename) {
+		assert.Equal(t, []string{"my-redis"}, rename.Query["name"])
+	}
+}
+
+func TestEngineInspect(t *testing.T) {
+	d := newFakeDaemon()
+	d.json("GET /containers/my-redis/json", map[string]interface{}{
+		"Name":  "/my-redis",
+		"Image": "a1b2c3",
+		"State": map[string]interface{}{"Running": true, "StartedAt": "2015-06-01T09:00:00Z"},
+	})
+	d.json("GET /images/redis/json", map[string]string{"Id": "a1b2c3"})
+	d.handlers["GET /containers/missing/json"] = func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no such id: missing", http.StatusNotFound)
+	}
+	e, _, _, done := newTestEngine(t, d)
+	defer done()
+
+	now := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	s, err := containerStatus(e, "label1", data.New().Set("name", "my-redis").Set("image", "redis"), now)
+	assert.NoError(t, err)
+	assert.Equal(t, "running", s.State)
+	assert.Equal(t, "3 hours", s.Uptime)
+	assert.True(t, s.ImageCurrent)
+
+	s, err = containerStatus(e, "", data.New().Set("name", "missing"), now)
+	assert.NoError(t, err)
+	assert.False(t, s.Exists)
+}
+
+func TestEngineLogs(t *testing.T) {
+	d := newFakeDaemon()
+	d.json("GET /containers/my-redis/json", map[string]interface{}{"Config": map[string]bool{"Tty": false}})
+	d.handlers["GET /containers/my-redis/logs"] = func(w http.ResponseWriter, r *http.Request) {
+		w.Write(frame(1, "ready\n"))
+	}
+	e, stdout, _, done := newTestEngine(t, d)
+	defer done()
+
+	assert.NoError(t, e.Exec(testCmd(t, "logs", "--name=my-redis", "--follow", "--tail=10", "--since=1433160000")))
+	assert.Equal(t, "ready\n", stdout.String())
+
+	logs := d.request("GET /containers/my-redis/logs")
+	if assert.NotNil(t, logs) {
+		assert.Equal(t, []string{"1"}, logs.Query["follow"])
+		assert.Equal(t, []string{"10"}, logs.Query["tail"])
+		assert.Equal(t, []string{"1433160000"}, logs.Query["since"])
+	}
+
+	now := time.Unix(1433160000, 0)
+	ts, err := engineTimestamp("1h", now)
+	assert.NoError(t, err)
+	assert.Equal(t, "1433156400", ts)
+	_, err = engineTimestamp("yesterday", now)
+	assert.Error(t, err)
+}
+
+func TestEnginePushPull(t *testing.T) {
+	d := newFakeDaemon()
+	d.handlers["POST /images/localhost:5000/foo/push"] = func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": "Pushing", "id": "foo"}` + "\n"))
+		w.Write([]byte(`{"error": "denied", "errorDetail": {"message": "access denied"}}` + "\n"))
+	}
+	e, stdout, _, done := newTestEngine(t, d)
+	defer done()
+
+	assert.NoError(t, e.Exec(testCmd(t, "pull", "--image=redis", "--tag=3")))
+	pull := d.request("POST /images/create")
+	if assert.NotNil(t, pull) {
+		assert.Equal(t, []string{"redis"}, pull.Query["fromImage"])
+		assert.Equal(t, []string{"3"}, pull.Query["tag"])
+	}
+
+	err := e.Exec(testCmd(t, "push", "--image=localhost:5000/foo", "--tag=bar"))
+	assert.Equal(t, &EngineError{Message: "access denied"}, err)
+	assert.Equal(t, "foo: Pushing\n", stdout.String())
+	push := d.request("POST /images/localhost:5000/foo/push")
+	if assert.NotNil(t, push) {
+		assert.Equal(t, []string{"bar"}, push.Query["tag"])
+	}
+}
+
+func TestEngineBuild(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fugu-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "secret"), []byte("psst"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, ".dockerignore"), []byte("secret\n"), 0644)
+
+	d := newFakeDaemon()
+	d.json("POST /build", map[string]string{"stream": "Successfully built abc123\n"})
+	e, stdout, _, done := newTestEngine(t, d)
+	defer done()
+
+	assert.NoError(t, e.Exec(testCmd(t, "build", "--image=foo", "--tag=bar", "--no-cache", dir)))
+	assert.Equal(t, "Successfully built abc123\n", stdout.String())
+
+	build := d.request("POST /build")
+	if assert.NotNil(t, build) {
+		assert.Equal(t, []string{"foo:bar"}, build.Query["t"])
+		assert.Equal(t, []string{"1"}, build.Query["nocache"])
+		assert.Equal(t, []string{"1"}, build.Query["rm"])
+
+		files := []string{}
+		r := tar.NewReader(bytes.NewReader(build.Body))
+		for {
+			h, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			if !assert.NoError(t, err) {
+				break
+			}
+			files = append(files, h.Name)
+		}
+		assert.Contains(t, files, "Dockerfile")
+		assert.NotContains(t, files, "secret")
+	}
+}
+
+func TestEngineUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fugu-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "docker.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := newFakeDaemon()
+	srv := httptest.NewUnstartedServer(d)
+	srv.Listener = l
+	srv.Start()
+	defer srv.Close()
+
+	defer os.Setenv("DOCKER_HOST", os.Getenv("DOCKER_HOST"))
+	os.Setenv("DOCKER_HOST", "unix://"+socket)
+
+	e, err := NewEngine("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Stdout = ioutil.Discard
+	assert.NoError(t, e.Exec(testCmd(t, "destroy", "--name=foo")))
+	assert.NotNil(t, d.request("DELETE /containers/foo"))
+}
+
+func TestExecBackend(t *testing.T) {
+	c := collect.New()
+	data, _, err := c.Parse([]string{"--backend=bogus"}, FuguFlags["run"])
+	assert.NoError(t, err)
+	assert.Equal(t, ErrUnknownBackend, Exec(data, &Cmd{Command: "ps"}, false))
+}
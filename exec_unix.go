@@ -0,0 +1,87 @@
+//go:build !windows
+// +build !windows
+
+package fugu
+
+import (
+	"golang.org/x/crypto/ssh/terminal"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// ShutdownTimeout is the time docker gets to exit after fugu received
+// SIGINT or SIGTERM. Afterwards docker's process group is killed.
+var ShutdownTimeout = 10 * time.Second
+
+// forwardSignals are passed on to docker's process group
+var forwardSignals = []os.Signal{
+	syscall.SIGINT,
+	syscall.SIGTERM,
+	syscall.SIGHUP,
+	syscall.SIGQUIT,
+	syscall.SIGWINCH,
+}
+
+// runForeground runs c in its own process group and forwards signals to it.
+// If stdin is a terminal, the process group becomes the foreground group of
+// the terminal, so docker can read from it and receives Ctrl-C and window
+// size changes directly. The terminal is handed back once docker exited.
+func runForeground(c *exec.Cmd) error {
+	tty := terminal.IsTerminal(int(os.Stdin.Fd()))
+
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if tty {
+		c.SysProcAttr.Foreground = true
+		c.SysProcAttr.Ctty = int(os.Stdin.Fd())
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, forwardSignals...)
+	defer signal.Stop(sigs)
+
+	if err := c.Start(); err != nil {
+		return err
+	}
+	if tty {
+		defer takeForeground(int(os.Stdin.Fd()))
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Wait()
+	}()
+
+	// with Setpgid the process group id equals the pid
+	pgid := c.Process.Pid
+
+	var kill <-chan time.Time
+	for {
+		select {
+		case err := <-done:
+			return err
+
+		case sig := <-sigs:
+			syscall.Kill(-pgid, sig.(syscall.Signal))
+			if kill == nil && (sig == syscall.SIGINT || sig == syscall.SIGTERM) {
+				kill = time.After(ShutdownTimeout)
+			}
+
+		case <-kill:
+			syscall.Kill(-pgid, syscall.SIGKILL)
+		}
+	}
+}
+
+// takeForeground makes fugu's process group the foreground group of fd again
+func takeForeground(fd int) {
+	// a background process group gets SIGTTOU when calling tcsetpgrp
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+
+	pgrp := syscall.Getpgrp()
+	syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), uintptr(syscall.TIOCSPGRP), uintptr(unsafe.Pointer(&pgrp)))
+}
@@ -0,0 +1,110 @@
+//go:build !windows
+// +build !windows
+
+package fugu
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// signalDocker is a fake docker recording the signals it receives
+const signalDocker = `#!/bin/sh
+trap 'echo INT >> "$SIGNAL_LOG"' INT
+trap 'echo WINCH >> "$SIGNAL_LOG"' WINCH
+trap 'echo HUP >> "$SIGNAL_LOG"' HUP
+trap 'echo TERM >> "$SIGNAL_LOG"; exit 143' TERM
+if [ "$2" = stubborn ]; then trap '' TERM; fi
+echo ready >> "$SIGNAL_LOG"
+while true; do sleep 0.05; done
+`
+
+func withSignalDocker(t *testing.T, f func(log string)) {
+	dir, err := ioutil.TempDir("", "fugu-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "docker"), []byte(signalDocker), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	log := filepath.Join(dir, "signals.log")
+	defer os.Unsetenv("SIGNAL_LOG")
+	os.Setenv("SIGNAL_LOG", log)
+
+	f(log)
+}
+
+// waitForLog waits until log contains line
+func waitForLog(t *testing.T, log, line string) {
+	for i := 0; i < 200; i++ {
+		buf, _ := ioutil.ReadFile(log)
+		for _, l := range strings.Split(string(buf), "\n") {
+			if l == line {
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("fake docker never logged %v", line)
+}
+
+func TestDockerExecForwardsSignals(t *testing.T) {
+	withSignalDocker(t, func(log string) {
+		done := make(chan error)
+		go func() {
+			done <- DockerExec(&Cmd{Command: "run"}, false)
+		}()
+
+		waitForLog(t, log, "ready")
+		syscall.Kill(os.Getpid(), syscall.SIGWINCH)
+		waitForLog(t, log, "WINCH")
+		syscall.Kill(os.Getpid(), syscall.SIGHUP)
+		waitForLog(t, log, "HUP")
+		syscall.Kill(os.Getpid(), syscall.SIGINT)
+		waitForLog(t, log, "INT")
+		syscall.Kill(os.Getpid(), syscall.SIGTERM)
+
+		select {
+		case err := <-done:
+			assert.Equal(t, &ExitError{Code: 143}, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("docker did not exit")
+		}
+
+		buf, _ := ioutil.ReadFile(log)
+		assert.Equal(t, "ready\nWINCH\nHUP\nINT\nTERM\n", string(buf))
+	})
+}
+
+func TestDockerExecKillsAfterShutdownTimeout(t *testing.T) {
+	defer func(d time.Duration) { ShutdownTimeout = d }(ShutdownTimeout)
+	ShutdownTimeout = 100 * time.Millisecond
+
+	withSignalDocker(t, func(log string) {
+		done := make(chan error)
+		go func() {
+			done <- DockerExec(&Cmd{Command: "run", Args: []string{"stubborn"}}, false)
+		}()
+
+		waitForLog(t, log, "ready")
+		syscall.Kill(os.Getpid(), syscall.SIGTERM)
+
+		select {
+		case err := <-done:
+			assert.Equal(t, &ExitError{Code: 137}, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("docker was not killed")
+		}
+	})
+}
@@ -0,0 +1,10 @@
+package fugu
+
+import (
+	"os/exec"
+)
+
+// runForeground runs c, signals reach docker via the console
+func runForeground(c *exec.Cmd) error {
+	return c.Run()
+}
@@ -14,360 +14,490 @@ import (
 	"sort"
 	"strings"
 	"text/tabwriter"
+	"time"
 )
 
-// DockerCommands return string that is always run
-var DockerCommands = make(map[string]func(c *collect.Collector, p *data.Data, args []string) (str string, err error))
-
-// Commands have more freedom and usually print to stdout/stderr directly
-var Commands = make(map[string]func(c *collect.Collector, p *data.Data, args []string) (err error))
-
 var (
-	ErrTooManyArgs   = errors.New("too many arguments given")
-	ErrMissingImage  = errors.New("image option is missing")
-	ErrMissingName   = errors.New("name option is missing")
-	ErrUnknownLabel  = errors.New("unknown label")
-	ErrTagGitBranch  = errors.New("tag-git-branch failed")
-	ErrMissingFlag   = errors.New("missing required flag")
-	ErrNoCredentials = errors.New("missing required credentials")
+	ErrTooManyArgs    = errors.New("too many arguments given")
+	ErrMissingImage   = errors.New("image option is missing")
+	ErrMissingName    = errors.New("name option is missing")
+	ErrTagGitBranch   = errors.New("tag-git-branch failed")
+	ErrMissingFlag    = errors.New("missing required flag")
+	ErrNoCredentials  = errors.New("missing required credentials")
+	ErrUnknownBackend = errors.New("unknown backend, use cli or api")
+	ErrNoContainer    = errors.New("container does not exist")
+	ErrConfigDrift    = errors.New("container differs from config")
+	ErrFixedHostPort  = errors.New("deploy needs dynamic host ports, i.e. publish: 80, or --stop-first for fixed ones")
+	ErrDeployFailed   = errors.New("deploy failed, the old container is still running")
+	ErrNotReady       = errors.New("container did not get ready")
+	ErrWaitNoDetach   = errors.New("wait-for options need --detach")
+	ErrWaitNoName     = errors.New("wait-for options need a name")
+	ErrNoLabels       = errors.New("no label selected")
+	ErrLabelsFailed   = errors.New("command failed for some labels")
+	ErrMissingShell   = errors.New("shell is missing, use bash, zsh or fish")
+	ErrUnknownShell   = errors.New("unknown shell, use bash, zsh or fish")
+	ErrUnknownFormat  = errors.New("unknown format, use roff, markdown or text")
+	ErrMissingTask    = errors.New("task is missing, see --list")
+	ErrUnknownTask    = errors.New("unknown task")
+	ErrEmptyTask      = errors.New("task has no command")
 )
 
-func init() {
+// cmdBuild builds the image at PATH, path or url
+func cmdBuild(c *collect.Collector, p *data.Data, args []string) (cmd *Cmd, err error) {
+	if p.Get("image") == "" {
+		return nil, ErrMissingImage
+	}
 
-	DockerCommands["build"] = func(c *collect.Collector, p *data.Data, args []string) (str string, err error) {
-		if p.Get("image") == "" {
-			return "", ErrMissingImage
+	if p.IsTrue("tag-git-branch") {
+		branchName, err := currentGitBranch()
+		if err != nil {
+			return nil, ErrTagGitBranch
 		}
+		p.Set("tag", branchName)
+	}
 
-		if p.IsTrue("tag-git-branch") {
-			branchName, err := currentGitBranch()
-			if err != nil {
-				return "", ErrTagGitBranch
-			}
-			p.Set("tag", branchName)
-		}
+	if p.Get("tag") != "" {
+		p.Set("tag", p.Get("image")+":"+p.Get("tag"))
+	} else {
+		p.Set("tag", p.Get("image"))
+	}
 
-		if p.Get("tag") != "" {
-			p.Set("tag", p.Get("image")+":"+p.Get("tag"))
-		} else {
-			p.Set("tag", p.Get("image"))
-		}
+	path := "."
+	if pathh := p.Get("path"); pathh != "" {
+		path = pathh
+	}
+	if url := p.Get("url"); url != "" {
+		path = url
+	}
 
-		path := "."
-		if pathh := p.Get("path"); pathh != "" {
-			path = pathh
-		}
-		if url := p.Get("url"); url != "" {
-			path = url
-		}
+	if len(args) == 1 {
+		path = args[0]
+	}
 
-		if len(args) == 1 {
-			path = args[0]
-		}
+	if len(args) > 1 {
+		return nil, ErrTooManyArgs
+	}
 
-		if len(args) > 1 {
-			return "", ErrTooManyArgs
-		}
+	pf, err := filterDockerFlags(p, "build")
+	if err != nil {
+		return nil, err
+	}
 
-		pf, err := filterDockerFlags(p, "build")
-		if err != nil {
-			return "", err
-		}
+	return buildDockerCmd("build", pf, path), nil
+}
 
-		return buildDockerStr("build", pf, path), nil
+// cmdRun runs a command in a new container
+func cmdRun(c *collect.Collector, p *data.Data, args []string) (cmd *Cmd, err error) {
+	if p.Get("image") == "" {
+		return nil, ErrMissingImage
 	}
 
-	DockerCommands["run"] = func(c *collect.Collector, p *data.Data, args []string) (str string, err error) {
-		if p.Get("image") == "" {
-			return "", ErrMissingImage
-		}
+	if p.IsTrue("replace") && p.Get("name") == "" {
+		return nil, ErrMissingName
+	}
 
-		dockerArgCommand := p.Get("command")
-		if len(args) > 0 {
-			dockerArgCommand = args[0]
-			args = args[1:]
-		}
+	dockerArgCommand := p.Get("command")
+	if len(args) > 0 {
+		dockerArgCommand = args[0]
+		args = args[1:]
+	}
 
-		dockerArgArgs := p.GetAll("arg")
+	dockerArgArgs := p.GetAll("arg")
 
-		if len(args) > 0 {
-			dockerArgArgs = args
-			args = args[:]
-		}
+	if len(args) > 0 {
+		dockerArgArgs = args
+		args = args[:]
+	}
 
-		nargs := []string{p.Get("image")}
-		if dockerArgCommand != "" {
-			nargs = append(nargs, dockerArgCommand)
-		}
-		if len(dockerArgArgs) > 0 {
-			nargs = append(nargs, dockerArgArgs...)
-		}
+	nargs := []string{p.Get("image")}
+	if dockerArgCommand != "" {
+		nargs = append(nargs, dockerArgCommand)
+	}
+	if len(dockerArgArgs) > 0 {
+		nargs = append(nargs, dockerArgArgs...)
+	}
 
-		pf, err := filterDockerFlags(p, "run")
-		if err != nil {
-			return "", err
-		}
+	pf, err := filterDockerFlags(p, "run")
+	if err != nil {
+		return nil, err
+	}
 
-		return buildDockerStr("run", pf, nargs...), nil
+	// stamp named containers, so that fugu diff can detect drift
+	if pf.Get("name") != "" {
+		pf.Set("label", append(withoutHashLabel(pf.GetAll("label")), ConfigHashLabel+"="+configHash(pf, nargs))...)
 	}
 
-	DockerCommands["exec"] = func(c *collect.Collector, p *data.Data, args []string) (str string, err error) {
-		if p.Get("name") == "" {
-			return "", ErrMissingName
-		}
+	return buildDockerCmd("run", pf, nargs...), nil
+}
 
-		dockerArgCommand := p.Get("command")
-		if len(args) > 0 {
-			dockerArgCommand = args[0]
-			args = args[1:]
-		}
+// cmdExec runs a command in a running container
+func cmdExec(c *collect.Collector, p *data.Data, args []string) (cmd *Cmd, err error) {
+	if p.Get("name") == "" {
+		return nil, ErrMissingName
+	}
 
-		dockerArgArgs := p.GetAll("arg")
-		if len(args) > 0 {
-			dockerArgArgs = args
-			args = args[:]
-		}
+	dockerArgCommand := p.Get("command")
+	if len(args) > 0 {
+		dockerArgCommand = args[0]
+		args = args[1:]
+	}
 
-		nargs := []string{p.Get("name")}
-		if dockerArgCommand != "" {
-			nargs = append(nargs, dockerArgCommand)
-		}
-		if len(dockerArgArgs) > 0 {
-			nargs = append(nargs, dockerArgArgs...)
-		}
+	dockerArgArgs := p.GetAll("arg")
+	if len(args) > 0 {
+		dockerArgArgs = args
+		args = args[:]
+	}
 
-		pf, err := filterDockerFlags(p, "exec")
-		if err != nil {
-			return "", err
-		}
+	nargs := []string{p.Get("name")}
+	if dockerArgCommand != "" {
+		nargs = append(nargs, dockerArgCommand)
+	}
+	if len(dockerArgArgs) > 0 {
+		nargs = append(nargs, dockerArgArgs...)
+	}
 
-		return buildDockerStr("exec", pf, nargs...), nil
+	pf, err := filterDockerFlags(p, "exec")
+	if err != nil {
+		return nil, err
 	}
 
-	DockerCommands["shell"] = func(c *collect.Collector, p *data.Data, args []string) (str string, err error) {
+	return buildDockerCmd("exec", pf, nargs...), nil
+}
 
-		p.SetTrue("interactive")
-		p.SetTrue("tty")
-		p.SetFalse("detach")
+// cmdShell opens a shell in a running container
+func cmdShell(c *collect.Collector, p *data.Data, args []string) (cmd *Cmd, err error) {
 
-		name := p.Get("name")
-		if name == "" {
-			return "", ErrMissingName
-		}
+	p.SetTrue("interactive")
+	p.SetTrue("tty")
+	p.SetFalse("detach")
 
-		if !p.Exists("shell") {
-			p.Set("shell", "/bin/bash")
-		}
+	name := p.Get("name")
+	if name == "" {
+		return nil, ErrMissingName
+	}
 
-		pf, err := filterDockerFlags(p, "exec")
-		if err != nil {
-			return "", err
-		}
+	if !p.Exists("shell") {
+		p.Set("shell", "/bin/bash")
+	}
 
-		return buildDockerStr("exec", pf, name, p.Get("shell")), nil
+	pf, err := filterDockerFlags(p, "exec")
+	if err != nil {
+		return nil, err
 	}
 
-	DockerCommands["destroy"] = func(c *collect.Collector, p *data.Data, args []string) (str string, err error) {
-		if p.Get("name") == "" {
-			return "", ErrMissingName
-		}
+	return buildDockerCmd("exec", pf, name, p.Get("shell")), nil
+}
 
-		if len(args) > 0 {
-			return "", ErrTooManyArgs
-		}
+// cmdDestroy kills and removes a container
+func cmdDestroy(c *collect.Collector, p *data.Data, args []string) (cmd *Cmd, err error) {
+	if p.Get("name") == "" {
+		return nil, ErrMissingName
+	}
 
-		return "docker rm -f " + p.Get("name"), nil
+	if len(args) > 0 {
+		return nil, ErrTooManyArgs
 	}
 
-	DockerCommands["push"] = func(c *collect.Collector, p *data.Data, args []string) (str string, err error) {
-		if p.Get("image") == "" {
-			return "", ErrMissingImage
-		}
+	return buildDockerCmd("rm", data.New().SetTrue("force"), p.Get("name")), nil
+}
 
-		tag := ""
-		if tagg := p.Get("tag"); tagg != "" {
-			tag = tagg
-		}
-		if len(args) > 0 {
-			tag = args[0]
-			args = args[1:]
-		}
+// cmdLogs fetches the logs of a container
+func cmdLogs(c *collect.Collector, p *data.Data, args []string) (cmd *Cmd, err error) {
+	if p.Get("name") == "" {
+		return nil, ErrMissingName
+	}
 
-		if len(args) > 0 {
-			return "", ErrTooManyArgs
-		}
+	if len(args) > 0 {
+		return nil, ErrTooManyArgs
+	}
 
-		image := p.Get("image")
-		if tag != "" {
-			image += ":" + tag
-		}
+	pf, err := filterDockerFlags(p, "logs")
+	if err != nil {
+		return nil, err
+	}
 
-		pf, err := filterDockerFlags(p, "push")
-		if err != nil {
-			return "", err
-		}
+	return buildDockerCmd("logs", pf, p.Get("name")), nil
+}
 
-		return buildDockerStr("push", pf, image), nil
+// cmdPush pushes an image
+func cmdPush(c *collect.Collector, p *data.Data, args []string) (cmd *Cmd, err error) {
+	if p.Get("image") == "" {
+		return nil, ErrMissingImage
 	}
 
-	DockerCommands["pull"] = func(c *collect.Collector, p *data.Data, args []string) (str string, err error) {
-		if p.Get("image") == "" {
-			return "", ErrMissingImage
-		}
+	tag := ""
+	if tagg := p.Get("tag"); tagg != "" {
+		tag = tagg
+	}
+	if len(args) > 0 {
+		tag = args[0]
+		args = args[1:]
+	}
 
-		tag := ""
-		if tagg := p.Get("tag"); tagg != "" {
-			tag = tagg
-		}
-		if len(args) > 0 {
-			tag = args[0]
-			args = args[1:]
-		}
+	if len(args) > 0 {
+		return nil, ErrTooManyArgs
+	}
 
-		if len(args) > 0 {
-			return "", ErrTooManyArgs
-		}
+	image := p.Get("image")
+	if tag != "" {
+		image += ":" + tag
+	}
 
-		image := p.Get("image")
-		if tag != "" {
-			image += ":" + tag
-		}
+	pf, err := filterDockerFlags(p, "push")
+	if err != nil {
+		return nil, err
+	}
 
-		pf, err := filterDockerFlags(p, "pull")
-		if err != nil {
-			return "", err
-		}
+	return buildDockerCmd("push", pf, image), nil
+}
 
-		return buildDockerStr("pull", pf, image), nil
+// cmdPull pulls an image
+func cmdPull(c *collect.Collector, p *data.Data, args []string) (cmd *Cmd, err error) {
+	if p.Get("image") == "" {
+		return nil, ErrMissingImage
 	}
 
-	Commands["show-data"] = func(c *collect.Collector, p *data.Data, args []string) error {
-		if len(args) > 1 {
-			return ErrTooManyArgs
-		}
+	tag := ""
+	if tagg := p.Get("tag"); tagg != "" {
+		tag = tagg
+	}
+	if len(args) > 0 {
+		tag = args[0]
+		args = args[1:]
+	}
 
-		found := false
-		for _, l := range c.Labels() {
-			if l == c.Label() {
-				found = true
-			}
-		}
-		if !found {
-			return nil
+	if len(args) > 0 {
+		return nil, ErrTooManyArgs
+	}
+
+	image := p.Get("image")
+	if tag != "" {
+		image += ":" + tag
+	}
+
+	pf, err := filterDockerFlags(p, "pull")
+	if err != nil {
+		return nil, err
+	}
+
+	return buildDockerCmd("pull", pf, image), nil
+}
+
+// cmdShowData prints the data of a label
+func cmdShowData(c *collect.Collector, p *data.Data, args []string) error {
+	if len(args) > 1 {
+		return ErrTooManyArgs
+	}
+
+	found := false
+	for _, l := range c.Labels() {
+		if l == c.Label() {
+			found = true
 		}
+	}
+	if !found {
+		return nil
+	}
 
-		out, err := yaml.Marshal(p.RawEnhanced())
+	// show-data options are no data
+	origin := p.IsTrue("origin")
+	p.Delete("origin")
+
+	if origin {
+		return writeDataOrigin(c, p)
+	}
+
+	out, err := yaml.Marshal(p.RawEnhanced())
+	if err != nil {
+		return err
+	}
+	outStr := strings.TrimSpace(fmt.Sprintf("%s", out))
+	if outStr != "{}" {
+		fmt.Println(outStr)
+	}
+	return nil
+}
+
+// writeDataOrigin prints p like show-data, with the source
+// of every value as comment
+func writeDataOrigin(c *collect.Collector, p *data.Data) error {
+	raw := p.RawEnhanced()
+	keys := p.Keys()
+	sort.Strings(keys)
+	for _, k := range keys {
+		out, err := yaml.Marshal(map[string]interface{}{k: raw[k]})
 		if err != nil {
 			return err
 		}
-		outStr := strings.TrimSpace(fmt.Sprintf("%s", out))
-		if outStr != "{}" {
-			fmt.Println(outStr)
-		}
-		return nil
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		lines[0] += " # " + c.Origin(k)
+		fmt.Println(strings.Join(lines, "\n"))
 	}
+	return nil
+}
 
-	Commands["show-labels"] = func(c *collect.Collector, p *data.Data, args []string) error {
-		if c.Label() != "" || len(args) > 0 {
-			return ErrTooManyArgs
-		}
-		labels := c.Labels()
-		if len(labels) > 0 {
-			sort.Sort(sort.StringSlice(labels))
-			for _, l := range labels {
-				fmt.Println(l)
-			}
+// cmdShowLabels prints all labels
+func cmdShowLabels(c *collect.Collector, p *data.Data, args []string) error {
+	if c.Label() != "" || len(args) > 0 {
+		return ErrTooManyArgs
+	}
+	labels := c.Labels()
+	if len(labels) > 0 {
+		sort.Sort(sort.StringSlice(labels))
+		for _, l := range labels {
+			fmt.Println(l)
 		}
-		return nil
 	}
+	return nil
+}
 
-	Commands["images"] = func(c *collect.Collector, p *data.Data, args []string) error {
-		registryStr := ""
-		if len(args) > 0 {
-			registryStr = args[0]
-			args = args[1:]
-		}
+// cmdStatus prints the status of the containers of labels
+func cmdStatus(c *collect.Collector, p *data.Data, args []string) error {
+	if len(args) > 0 {
+		return ErrTooManyArgs
+	}
+
+	ins, err := newInspector(p.Get("backend"))
+	if err != nil {
+		return err
+	}
 
-		if len(args) > 0 {
-			return ErrTooManyArgs
+	// without label, show the status of all labels
+	statuses := make([]*ContainerStatus, 0)
+	labels := c.Labels()
+	if c.Label() != "" || len(labels) == 0 {
+		if p.Get("name") == "" {
+			return ErrMissingName
+		}
+		s, err := containerStatus(ins, c.Label(), p, time.Now())
+		if err != nil {
+			return err
 		}
+		statuses = append(statuses, s)
 
-		// show local docker images
-		if registryStr == "" {
-			if os.Getenv("GOTEST") != "" {
-				fmt.Println("<local docker images shown>")
-			} else {
-				DockerExec("docker images", false)
+	} else {
+		sort.Sort(sort.StringSlice(labels))
+		for _, l := range labels {
+			lp, err := labelData(c, l, FuguFlags["status"])
+			if err != nil {
+				return err
 			}
-			return nil
+			s, err := containerStatus(ins, l, lp, time.Now())
+			if err != nil {
+				return err
+			}
+			statuses = append(statuses, s)
 		}
+	}
 
-		// show docker images in other registryStr ...
-		if (p.Exists("user") || p.Exists("password") || p.Exists("password-stdin")) && p.Exists("file") {
-			return ErrTooManyArgs
-		}
-		if (p.Exists("password") || p.Exists("password-stdin")) && !p.Exists("user") {
-			return ErrMissingFlag
-		}
+	return writeStatus(os.Stdout, statuses, p.IsTrue("json"))
+}
 
-		user := ""
-		if p.Exists("user") {
-			user = p.Get("user")
-		}
+// cmdDiff prints how a container differs from its config
+func cmdDiff(c *collect.Collector, p *data.Data, args []string) error {
+	if p.Get("name") == "" {
+		return ErrMissingName
+	}
 
-		password := ""
-		if p.Exists("password") {
-			password = p.Get("password")
-		} else if p.Exists("password-stdin") {
-			fmt.Print("Password for '" + registryStr + "': ")
-			password = string(gopass.GetPasswd())
-		}
+	// compare with what fugu run would run now
+	cmd, err := cmdRun(c, p, args)
+	if err != nil {
+		return err
+	}
 
-		if !p.Exists("user") {
-			// read credentials from file
-			file := p.Get("file")
-			if file == "" {
-				file = "~/.dockercfg"
-			}
+	ins, err := newInspector(p.Get("backend"))
+	if err != nil {
+		return err
+	}
+	return diffContainer(ins, cmd)
+}
 
-			rootPath, err := tilde.Expand(file)
-			if err != nil {
-				return fmt.Errorf("images: %v", err.Error())
-			}
+// cmdImages lists local images or the images of a registry
+func cmdImages(c *collect.Collector, p *data.Data, args []string) error {
+	registryStr := ""
+	if len(args) > 0 {
+		registryStr = args[0]
+		args = args[1:]
+	}
 
-			// TODO docker.registry sets CONFIGFILE as const
-			// so we can't change it, see
-			// https://github.com/docker/docker/blob/v1.5.0/registry/auth.go#L22
-			// using at least path information from file flag as a work-around
-			rootPath = filepath.Dir(rootPath)
+	if len(args) > 0 {
+		return ErrTooManyArgs
+	}
 
-			allConfig, err := registry.LoadConfig(rootPath)
-			if err != nil {
-				return fmt.Errorf("images: %v", err.Error())
-			}
+	// show local docker images
+	if registryStr == "" {
+		if os.Getenv("GOTEST") != "" {
+			fmt.Println("<local docker images shown>")
+			return nil
+		}
+		return DockerExec(&Cmd{Command: "images"}, false)
+	}
 
-			if config, ok := allConfig.Configs[registryStr]; ok {
-				user = config.Username
-				password = config.Password
-			}
+	// show docker images in other registryStr ...
+	if (p.Exists("user") || p.Exists("password") || p.Exists("password-stdin")) && p.Exists("file") {
+		return ErrTooManyArgs
+	}
+	if (p.Exists("password") || p.Exists("password-stdin")) && !p.Exists("user") {
+		return ErrMissingFlag
+	}
+
+	user := ""
+	if p.Exists("user") {
+		user = p.Get("user")
+	}
+
+	password := ""
+	if p.Exists("password") {
+		password = p.Get("password")
+	} else if p.Exists("password-stdin") {
+		fmt.Print("Password for '" + registryStr + "': ")
+		password = string(gopass.GetPasswd())
+	}
+
+	if !p.Exists("user") {
+		// read credentials from file
+		file := p.Get("file")
+		if file == "" {
+			file = "~/.dockercfg"
 		}
 
-		if user == "" || password == "" {
-			return ErrNoCredentials
+		rootPath, err := tilde.Expand(file)
+		if err != nil {
+			return fmt.Errorf("images: %v", err.Error())
 		}
 
-		images, err := ListImages(registryStr, user, password)
+		// TODO docker.registry sets CONFIGFILE as const
+		// so we can't change it, see
+		// https://github.com/docker/docker/blob/v1.5.0/registry/auth.go#L22
+		// using at least path information from file flag as a work-around
+		rootPath = filepath.Dir(rootPath)
+
+		allConfig, err := registry.LoadConfig(rootPath)
 		if err != nil {
 			return fmt.Errorf("images: %v", err.Error())
 		}
 
-		w := new(tabwriter.Writer)
-		w.Init(os.Stdout, 0, 8, 2, '\t', 0)
-		for _, v := range images {
-			fmt.Fprintf(w, "%v\t%v\n", v.Name, strings.Join(v.Tags, ", "))
+		if config, ok := allConfig.Configs[registryStr]; ok {
+			user = config.Username
+			password = config.Password
 		}
-		w.Flush()
+	}
 
-		return nil
+	if user == "" || password == "" {
+		return ErrNoCredentials
 	}
+
+	images, err := ListImages(registryStr, user, password)
+	if err != nil {
+		return fmt.Errorf("images: %v", err.Error())
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 2, '\t', 0)
+	for _, v := range images {
+		fmt.Fprintf(w, "%v\t%v\n", v.Name, strings.Join(v.Tags, ", "))
+	}
+	w.Flush()
+
+	return nil
 }
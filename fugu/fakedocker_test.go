@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// The test binary doubles as fugu and as a fake docker binary.
+// fakeDocker puts a symlink named docker to the test binary on PATH,
+// which records every call and answers with canned responses.
+
+const (
+	envRunMain    = "RUN_FUGU_MAIN"
+	envFakeDocker = "FAKE_DOCKER_DIR"
+)
+
+func TestMain(m *testing.M) {
+	if filepath.Base(os.Args[0]) == "docker" {
+		os.Exit(fakeDockerMain())
+	}
+	if os.Getenv(envRunMain) != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeResponse is what the fake docker prints and how it exits
+type fakeResponse struct {
+	Stdout string
+	Stderr string
+	Exit   int
+}
+
+// fakeCall is a recorded call of the fake docker
+type fakeCall struct {
+	Argv  []string
+	Env   []string
+	Stdin string
+}
+
+// Getenv returns the value of an environment variable of the call
+func (c fakeCall) Getenv(key string) string {
+	for _, e := range c.Env {
+		if strings.HasPrefix(e, key+"=") {
+			return strings.TrimPrefix(e, key+"=")
+		}
+	}
+	return ""
+}
+
+// fakeDockerMain runs as docker
+func fakeDockerMain() int {
+	dir := os.Getenv(envFakeDocker)
+	stdin, _ := ioutil.ReadAll(os.Stdin)
+
+	buf, _ := json.Marshal(fakeCall{
+		Argv:  os.Args[1:],
+		Env:   os.Environ(),
+		Stdin: string(stdin),
+	})
+	f, err := os.OpenFile(filepath.Join(dir, "calls"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		panic(err)
+	}
+	f.Write(append(buf, '\n'))
+	f.Close()
+
+	responses := make(map[string][]fakeResponse)
+	if buf, err := ioutil.ReadFile(filepath.Join(dir, "responses")); err == nil {
+		json.Unmarshal(buf, &responses)
+	}
+
+	// the longest matching prefix of the arguments wins
+	args := strings.Join(os.Args[1:], " ")
+	match := ""
+	found := false
+	for prefix := range responses {
+		if (args == prefix || strings.HasPrefix(args, prefix+" ")) && len(prefix) >= len(match) {
+			match = prefix
+			found = true
+		}
+	}
+	if !found {
+		return 0
+	}
+
+	// sequenced responses are used one per matching call, the last one sticks
+	n := -1
+	for _, c := range readCalls(dir) {
+		a := strings.Join(c.Argv, " ")
+		if a == match || strings.HasPrefix(a, match+" ") {
+			n++
+		}
+	}
+	seq := responses[match]
+	if n >= len(seq) {
+		n = len(seq) - 1
+	}
+	r := seq[n]
+	os.Stdout.WriteString(r.Stdout)
+	os.Stderr.WriteString(r.Stderr)
+	return r.Exit
+}
+
+type fakeDocker struct {
+	// Env is added to fugu's environment
+	Env []string
+
+	t         *testing.T
+	dir       string
+	responses map[string][]fakeResponse
+}
+
+func newFakeDocker(t *testing.T) *fakeDocker {
+	dir, err := ioutil.TempDir("", "fugu-fake-docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin, err := filepath.Abs(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(bin, filepath.Join(dir, "docker")); err != nil {
+		t.Fatal(err)
+	}
+	return &fakeDocker{
+		t:         t,
+		dir:       dir,
+		responses: make(map[string][]fakeResponse),
+	}
+}
+
+func (d *fakeDocker) Close() {
+	os.RemoveAll(d.dir)
+}
+
+// Respond sets the response for calls starting with the
+// space separated arguments in prefix, i.e. "inspect --type=container my-redis".
+// Several responses are answered in sequence.
+func (d *fakeDocker) Respond(prefix string, r ...fakeResponse) {
+	d.responses[prefix] = r
+	buf, _ := json.Marshal(d.responses)
+	if err := ioutil.WriteFile(filepath.Join(d.dir, "responses"), buf, 0644); err != nil {
+		d.t.Fatal(err)
+	}
+}
+
+// Calls returns all recorded calls
+func (d *fakeDocker) Calls() []fakeCall {
+	return readCalls(d.dir)
+}
+
+// readCalls reads the calls recorded in dir
+func readCalls(dir string) []fakeCall {
+	calls := []fakeCall{}
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "calls"))
+	if err != nil {
+		return calls
+	}
+	for _, l := range bytes.Split(bytes.TrimSpace(buf), []byte("\n")) {
+		var c fakeCall
+		if err := json.Unmarshal(l, &c); err == nil {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Argvs returns the arguments of all recorded calls
+func (d *fakeDocker) Argvs() [][]string {
+	argvs := [][]string{}
+	for _, c := range d.Calls() {
+		argvs = append(argvs, c.Argv)
+	}
+	return argvs
+}
+
+// Fugu runs fugu's main() with args and stdin
+func (d *fakeDocker) Fugu(stdin string, args ...string) (stdout, stderr string, exit int) {
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Stdin = strings.NewReader(stdin)
+
+	var outBuf, errBuf bytes.Buffer
+	cmd.Stdout = &outBuf
+	cmd.Stderr = &errBuf
+
+	cmd.Env = []string{
+		envRunMain + "=1",
+		envFakeDocker + "=" + d.dir,
+		"PATH=" + d.dir + string(os.PathListSeparator) + os.Getenv("PATH"),
+		"HOME=" + os.Getenv("HOME"),
+	}
+	cmd.Env = append(cmd.Env, d.Env...)
+
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		exit = exitErr.Sys().(syscall.WaitStatus).ExitStatus()
+	} else if err != nil {
+		d.t.Fatal(err)
+	}
+	return outBuf.String(), errBuf.String(), exit
+}
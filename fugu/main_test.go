@@ -0,0 +1,722 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mattes/fugu"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMainRun(t *testing.T) {
+	d := newFakeDocker(t)
+	defer d.Close()
+
+	stdout, _, exit := d.Fugu("", "run", "--image=foo", "--env=A=$HOME `id`", "--name=my foo", "echo", "a b")
+	assert.Equal(t, 0, exit)
+	assert.Equal(t, "docker run --env='A=$HOME `id`' --label=fugu.hash=4a49f1543411 --name='my foo' foo echo 'a b'\n", stdout)
+	assert.Equal(t, [][]string{
+		{"run", "--env=A=$HOME `id`", "--label=fugu.hash=4a49f1543411", "--name=my foo", "foo", "echo", "a b"},
+	}, d.Argvs())
+}
+
+func TestMainRunWithLabel(t *testing.T) {
+	d := newFakeDocker(t)
+	defer d.Close()
+
+	_, _, exit := d.Fugu("", "run", "label1", "--source=file://../examples/fugu.labels.yml", "--detach")
+	assert.Equal(t, 0, exit)
+	assert.Equal(t, [][]string{
+		{"run", "--detach", "--label=fugu.hash=006abedb93ff", "--name=my-redis", "redis"},
+	}, d.Argvs())
+}
+
+func TestMainDryRun(t *testing.T) {
+	d := newFakeDocker(t)
+	defer d.Close()
+
+	stdout, _, exit := d.Fugu("", "destroy", "--name=foo", "--dry-run")
+	assert.Equal(t, 0, exit)
+	assert.Equal(t, "docker rm --force foo\n", stdout)
+	assert.Empty(t, d.Calls())
+}
+
+func TestMainExitCode(t *testing.T) {
+	d := newFakeDocker(t)
+	defer d.Close()
+
+	d.Respond("run", fakeResponse{Stdout: "starting\n", Stderr: "killed\n", Exit: 137})
+	stdout, stderr, exit := d.Fugu("", "run", "--image=foo")
+	assert.Equal(t, 137, exit)
+	assert.Equal(t, "docker run foo\nstarting\n", stdout)
+	assert.Equal(t, "killed\n", stderr)
+
+	d.Respond("exec --interactive foo false", fakeResponse{Exit: 1})
+	_, stderr, exit = d.Fugu("", "exec", "--name=foo", "--interactive", "false")
+	assert.Equal(t, 1, exit)
+	assert.Empty(t, stderr)
+
+	_, _, exit = d.Fugu("", "exec", "--name=foo", "--interactive", "true")
+	assert.Equal(t, 0, exit)
+}
+
+func TestMainFuguError(t *testing.T) {
+	d := newFakeDocker(t)
+	defer d.Close()
+
+	_, stderr, exit := d.Fugu("", "run")
+	assert.Equal(t, 1, exit)
+	assert.Equal(t, "Error: image option is missing\n", stderr)
+	assert.Empty(t, d.Calls())
+}
+
+func TestMainShell(t *testing.T) {
+	d := newFakeDocker(t)
+	defer d.Close()
+
+	d.Env = []string{"DOCKER_HOST=tcp://127.0.0.1:2375"}
+	d.Respond("exec", fakeResponse{Stdout: "root@foo:/# "})
+	stdout, _, exit := d.Fugu("ls /\nexit\n", "shell", "--name=foo", "--shell=/bin/sh")
+	assert.Equal(t, 0, exit)
+	assert.Equal(t, "docker exec --detach=false --interactive --tty foo /bin/sh\nroot@foo:/# ", stdout)
+
+	calls := d.Calls()
+	if assert.Len(t, calls, 1) {
+		assert.Equal(t, []string{"exec", "--detach=false", "--interactive", "--tty", "foo", "/bin/sh"}, calls[0].Argv)
+		assert.Equal(t, "ls /\nexit\n", calls[0].Stdin)
+		assert.Equal(t, "tcp://127.0.0.1:2375", calls[0].Getenv("DOCKER_HOST"))
+	}
+}
+
+func TestMainImages(t *testing.T) {
+	d := newFakeDocker(t)
+	defer d.Close()
+
+	d.Respond("images", fakeResponse{Stdout: "REPOSITORY TAG\nredis latest\n"})
+	stdout, _, exit := d.Fugu("", "images")
+	assert.Equal(t, 0, exit)
+	assert.Equal(t, "REPOSITORY TAG\nredis latest\n", stdout)
+	assert.Equal(t, [][]string{{"images"}}, d.Argvs())
+}
+
+func TestMainStatus(t *testing.T) {
+	d := newFakeDocker(t)
+	defer d.Close()
+
+	d.Respond("inspect --type=container my-redis", fakeResponse{Stdout: `[{"Name": "/my-redis", "Image": "a1b2c3", "State": {"Status": "exited", "ExitCode": 1}}]`})
+	d.Respond("inspect --type=image redis", fakeResponse{Stdout: `[{"Id": "d4e5f6"}]`})
+	d.Respond("inspect --type=container another-ubuntu", fakeResponse{Stderr: "Error: No such image or container: another-ubuntu\n", Exit: 1})
+
+	stdout, stderr, exit := d.Fugu("", "status", "--source=file://../examples/fugu.labels.yml")
+	assert.Equal(t, 0, exit, stderr)
+	assert.Equal(t, `LABEL   NAME            STATE    UPTIME  EXIT CODE  IMAGE ID  IMAGE CURRENT  PORTS
+label1  my-redis        exited   -       1          a1b2c3    no             -
+label2  another-ubuntu  missing  -       -          -         -              -
+`, stdout)
+
+	stdout, _, exit = d.Fugu("", "status", "label1", "--source=file://../examples/fugu.labels.yml", "--json")
+	assert.Equal(t, 0, exit)
+	assert.Contains(t, stdout, `"state": "exited"`)
+	assert.Equal(t, [][]string{
+		{"inspect", "--type=container", "my-redis"},
+		{"inspect", "--type=image", "redis"},
+		{"inspect", "--type=container", "another-ubuntu"},
+		{"inspect", "--type=container", "my-redis"},
+		{"inspect", "--type=image", "redis"},
+	}, d.Argvs())
+}
+
+func TestMainStatusImageNamedLikeContainer(t *testing.T) {
+	d := newFakeDocker(t)
+	defer d.Close()
+
+	d.Respond("inspect --type=container my-app", fakeResponse{Stdout: `[{"Name": "/my-app", "Image": "a1b2c3", "State": {"Running": true}}]`})
+	d.Respond("inspect --type=image my-app", fakeResponse{Stdout: `[{"Id": "a1b2c3"}]`})
+
+	stdout, stderr, exit := d.Fugu("", "status", "app", "--source=file://../examples/fugu.hooks.yml", "--json")
+	assert.Equal(t, 0, exit, stderr)
+	assert.Contains(t, stdout, `"image_current": true`)
+}
+
+func TestMainDiff(t *testing.T) {
+	d := newFakeDocker(t)
+	defer d.Close()
+
+	d.Respond("inspect --type=container my-redis", fakeResponse{Stdout: `[{"Name": "/my-redis", "Image": "a1b2c3",
+		"Config": {"Image": "redis", "Env": ["A=1"], "Labels": {"fugu.hash": "006abedb93ff"}}}]`})
+	d.Respond("inspect --type=image a1b2c3", fakeResponse{Stdout: `[{"Id": "a1b2c3"}]`})
+	d.Respond("inspect --type=image redis", fakeResponse{Stdout: `[{"Id": "a1b2c3"}]`})
+
+	stdout, stderr, exit := d.Fugu("", "diff", "label1", "--source=file://../examples/fugu.labels.yml")
+	assert.Equal(t, 1, exit)
+	assert.Equal(t, "env\n  - A=1\n", stdout)
+	assert.Equal(t, "Error: container differs from config\n", stderr)
+
+	stdout, _, exit = d.Fugu("", "diff", "label1", "--source=file://../examples/fugu.labels.yml", "--env=A=1")
+	assert.Equal(t, 1, exit)
+	assert.Equal(t, "fugu.hash\n  - 006abedb93ff\n  + 00624b4fb8f8\n", stdout)
+
+	d.Respond("inspect --type=container another-ubuntu", fakeResponse{Stderr: "Error: No such image or container: another-ubuntu\n", Exit: 1})
+	_, stderr, exit = d.Fugu("", "diff", "label2", "--source=file://../examples/fugu.labels.yml", "--image=ubuntu")
+	assert.Equal(t, 1, exit)
+	assert.Equal(t, "Error: container does not exist\n", stderr)
+}
+
+func TestMainDiffWaitFor(t *testing.T) {
+	d := newFakeDocker(t)
+	defer d.Close()
+
+	fugufile := filepath.Join(d.dir, "fugu.yml")
+	if err := ioutil.WriteFile(fugufile, []byte("web:\n  image: nginx\n  name: web\n  wait-for-port: 80\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	source := "--source=file://" + fugufile
+
+	// wait-for keys only matter for a detached run
+	d.Respond("inspect --type=container web", fakeResponse{Stdout: `[{"Name": "/web", "Image": "a1b2c3",
+		"Config": {"Image": "nginx", "Labels": {"fugu.hash": "e3e4b6e0a0d5"}}}]`})
+	d.Respond("inspect --type=image", fakeResponse{Stdout: `[{"Id": "a1b2c3"}]`})
+	stdout, stderr, exit := d.Fugu("", "diff", "web", source)
+	assert.NotContains(t, stderr, "wait-for")
+	assert.Contains(t, stdout, "fugu.hash")
+	assert.Equal(t, 1, exit)
+
+	stdout, stderr, exit = d.Fugu("", "run", "web", source, "--dry-run")
+	assert.Equal(t, 0, exit, stderr)
+	assert.Contains(t, stdout, "docker run ")
+
+	_, stderr, exit = d.Fugu("", "run", "web", source)
+	assert.Equal(t, 1, exit)
+	assert.Equal(t, "Error: wait-for options need --detach\n", stderr)
+}
+
+func TestMainUp(t *testing.T) {
+	labels := "--source=file://../examples/fugu.labels.yml"
+	running := `[{"Name": "/my-redis", "Image": "a1b2c3", "State": {"Running": %v},
+		"Config": {"Labels": {"fugu.hash": "006abedb93ff"}}}]`
+	noSuch := fakeResponse{Stderr: "Error: No such image or container: my-redis\n", Exit: 1}
+	runArgv := []string{"run", "--detach", "--label=fugu.hash=006abedb93ff", "--name=my-redis", "redis"}
+
+	for _, tt := range []struct {
+		desc      string
+		container fakeResponse
+		imageID   string
+		args      []string
+		stdout    string
+		argvs     [][]string
+	}{
+		{
+			desc:      "missing container is created",
+			container: noSuch,
+			stdout:    "docker run --detach --label=fugu.hash=006abedb93ff --name=my-redis redis\nmy-redis: created\n",
+			argvs:     [][]string{{"inspect", "--type=container", "my-redis"}, runArgv},
+		},
+		{
+			desc:      "running container is left alone",
+			container: fakeResponse{Stdout: fmt.Sprintf(running, true)},
+			imageID:   "a1b2c3",
+			stdout:    "my-redis: unchanged\n",
+			argvs:     [][]string{{"inspect", "--type=container", "my-redis"}, {"inspect", "--type=image", "redis"}},
+		},
+		{
+			desc:      "stopped container is started",
+			container: fakeResponse{Stdout: fmt.Sprintf(running, false)},
+			imageID:   "a1b2c3",
+			stdout:    "docker start my-redis\nmy-redis: started\n",
+			argvs:     [][]string{{"inspect", "--type=container", "my-redis"}, {"inspect", "--type=image", "redis"}, {"start", "my-redis"}},
+		},
+		{
+			desc:      "new image recreates container",
+			container: fakeResponse{Stdout: fmt.Sprintf(running, true)},
+			imageID:   "d4e5f6",
+			stdout:    "docker rm --force my-redis\ndocker run --detach --label=fugu.hash=006abedb93ff --name=my-redis redis\nmy-redis: recreated, image changed\n",
+			argvs:     [][]string{{"inspect", "--type=container", "my-redis"}, {"inspect", "--type=image", "redis"}, {"rm", "--force", "my-redis"}, runArgv},
+		},
+		{
+			desc:      "changed config recreates container",
+			container: fakeResponse{Stdout: fmt.Sprintf(running, true)},
+			imageID:   "a1b2c3",
+			args:      []string{"--env=A=1"},
+			stdout:    "docker rm --force my-redis\ndocker run --detach --env=A=1 --label=fugu.hash=00624b4fb8f8 --name=my-redis redis\nmy-redis: recreated, config changed\n",
+			argvs: [][]string{{"inspect", "--type=container", "my-redis"}, {"rm", "--force", "my-redis"},
+				{"run", "--detach", "--env=A=1", "--label=fugu.hash=00624b4fb8f8", "--name=my-redis", "redis"}},
+		},
+		{
+			desc:      "path builds first",
+			container: fakeResponse{Stdout: fmt.Sprintf(running, true)},
+			imageID:   "a1b2c3",
+			args:      []string{"--path=.", "--no-cache"},
+			stdout:    "docker build --no-cache --tag=redis .\nmy-redis: unchanged\n",
+			argvs:     [][]string{{"build", "--no-cache", "--tag=redis", "."}, {"inspect", "--type=container", "my-redis"}, {"inspect", "--type=image", "redis"}},
+		},
+		{
+			desc:      "dry-run only inspects",
+			container: fakeResponse{Stdout: fmt.Sprintf(running, true)},
+			imageID:   "d4e5f6",
+			args:      []string{"--dry-run"},
+			stdout:    "docker rm --force my-redis\ndocker run --detach --label=fugu.hash=006abedb93ff --name=my-redis redis\nmy-redis: recreated, image changed\n",
+			argvs:     [][]string{{"inspect", "--type=container", "my-redis"}, {"inspect", "--type=image", "redis"}},
+		},
+	} {
+		d := newFakeDocker(t)
+		d.Respond("inspect --type=container my-redis", tt.container)
+		d.Respond("inspect --type=image redis", fakeResponse{Stdout: `[{"Id": "` + tt.imageID + `"}]`})
+
+		stdout, stderr, exit := d.Fugu("", append([]string{"up", "label1", labels}, tt.args...)...)
+		assert.Equal(t, 0, exit, tt.desc+": "+stderr)
+		assert.Equal(t, tt.stdout, stdout, tt.desc)
+		assert.Equal(t, tt.argvs, d.Argvs(), tt.desc)
+		d.Close()
+	}
+}
+
+func TestMainRunReplace(t *testing.T) {
+	d := newFakeDocker(t)
+	defer d.Close()
+
+	// no old container
+	d.Respond("inspect --type=container foo", fakeResponse{Stderr: "Error: No such image or container: foo\n", Exit: 1})
+	stdout, _, exit := d.Fugu("", "run", "--image=redis", "--name=foo", "--replace")
+	assert.Equal(t, 0, exit)
+	assert.Equal(t, "docker run --label=fugu.hash=e3aae4c5d5d7 --name=foo redis\n", stdout)
+
+	// running old container
+	d.Respond("inspect --type=container foo", fakeResponse{Stdout: `[{"Name": "/foo", "State": {"Running": true}}]`})
+	stdout, _, exit = d.Fugu("", "run", "--image=redis", "--name=foo", "--replace", "--replace-timeout=3")
+	assert.Equal(t, 0, exit)
+	assert.Equal(t, "docker stop --time=3 foo\ndocker rm foo\ndocker run --label=fugu.hash=e3aae4c5d5d7 --name=foo redis\n", stdout)
+
+	// new container fails
+	d.Respond("inspect --type=container foo", fakeResponse{Stdout: `[{"Name": "/foo", "State": {"ExitCode": 2, "FinishedAt": "2015-06-01T12:00:00Z"}}]`})
+	d.Respond("run", fakeResponse{Stderr: "conflict\n", Exit: 125})
+	_, stderr, exit := d.Fugu("", "run", "--image=redis", "--name=foo", "--replace")
+	assert.Equal(t, 125, exit)
+	assert.Equal(t, "conflict\nreplace: old container foo exited with status 2 at 2015-06-01T12:00:00Z and was removed\n", stderr)
+
+	assert.Equal(t, [][]string{
+		{"inspect", "--type=container", "foo"},
+		{"run", "--label=fugu.hash=e3aae4c5d5d7", "--name=foo", "redis"},
+		{"inspect", "--type=container", "foo"},
+		{"stop", "--time=3", "foo"},
+		{"inspect", "--type=container", "foo"},
+		{"rm", "foo"},
+		{"run", "--label=fugu.hash=e3aae4c5d5d7", "--name=foo", "redis"},
+		{"inspect", "--type=container", "foo"},
+		{"rm", "foo"},
+		{"run", "--label=fugu.hash=e3aae4c5d5d7", "--name=foo", "redis"},
+	}, d.Argvs())
+}
+
+func TestMainDeploy(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	noSuch := fakeResponse{Stderr: "Error: No such image or container\n", Exit: 1}
+	starting := fakeResponse{Stdout: `[{"Name": "/web-fugu-next", "State": {"Running": true}, "NetworkSettings": {"Ports": {"80/tcp": [{"HostIp": "0.0.0.0", "HostPort": "1"}]}}}]`}
+	answering := fakeResponse{Stdout: `[{"Name": "/web-fugu-next", "State": {"Running": true}, "NetworkSettings": {"Ports": {"80/tcp": [{"HostIp": "0.0.0.0", "HostPort": "` + port + `"}]}}}]`}
+	exited := fakeResponse{Stdout: `[{"Name": "/web-fugu-next", "State": {"ExitCode": 3}}]`}
+	old := fakeResponse{Stdout: `[{"Name": "/web", "State": {"Running": true}}]`}
+	runArgv := []string{"run", "--detach", "--label=fugu.hash=c4f881b1f26c", "--name=web-fugu-next", "--publish=80", "nginx"}
+	args := []string{"deploy", "--image=nginx", "--name=web", "--publish=80"}
+
+	// new container answers on its port after a while
+	d := newFakeDocker(t)
+	d.Respond("inspect --type=container web-fugu-next", noSuch, starting, answering)
+	d.Respond("inspect --type=container web", old)
+	stdout, stderr, exit := d.Fugu("", args...)
+	assert.Equal(t, 0, exit, stderr)
+	assert.Equal(t, "docker run --detach --label=fugu.hash=c4f881b1f26c --name=web-fugu-next --publish=80 nginx\n"+
+		"docker rm --force web\ndocker rename web-fugu-next web\nweb: deployed\n", stdout)
+	assert.Equal(t, [][]string{
+		{"inspect", "--type=container", "web-fugu-next"},
+		runArgv,
+		{"inspect", "--type=container", "web-fugu-next"},
+		{"inspect", "--type=container", "web-fugu-next"},
+		{"inspect", "--type=container", "web"},
+		{"rm", "--force", "web"},
+		{"rename", "web-fugu-next", "web"},
+	}, d.Argvs())
+	d.Close()
+
+	// new container exits, the old one is left alone
+	d = newFakeDocker(t)
+	d.Respond("inspect --type=container web-fugu-next", noSuch, exited)
+	d.Respond("logs", fakeResponse{Stderr: "boom\n"})
+	_, stderr, exit = d.Fugu("", args...)
+	assert.Equal(t, 1, exit)
+	assert.Equal(t, "deploy: container exited with status 3, rolling back\n"+
+		"last log lines of web-fugu-next:\nboom\n"+
+		"Error: deploy failed, the old container is still running\n", stderr)
+	assert.Equal(t, [][]string{
+		{"inspect", "--type=container", "web-fugu-next"},
+		runArgv,
+		{"inspect", "--type=container", "web-fugu-next"},
+		{"logs", "--tail=10", "web-fugu-next"},
+		{"rm", "--force", "web-fugu-next"},
+	}, d.Argvs())
+	d.Close()
+
+	// new container never answers
+	d = newFakeDocker(t)
+	d.Respond("inspect --type=container web-fugu-next", starting)
+	_, stderr, exit = d.Fugu("", append(args, "--deploy-timeout=0")...)
+	assert.Equal(t, 1, exit)
+	assert.Contains(t, stderr, "deploy: container web-fugu-next not ready after 0")
+	assert.Equal(t, []string{"rm", "--force", "web-fugu-next"}, d.Argvs()[len(d.Argvs())-1])
+	d.Close()
+
+	// fixed host ports can't be deployed side by side
+	d = newFakeDocker(t)
+	_, stderr, exit = d.Fugu("", "deploy", "--image=nginx", "--name=web", "--publish=8080:80")
+	assert.Equal(t, 1, exit)
+	assert.Equal(t, "Error: deploy needs dynamic host ports, i.e. publish: 80, or --stop-first for fixed ones\n", stderr)
+	assert.Empty(t, d.Calls())
+	d.Close()
+
+	// deploy-timeout is the only timeout of deploy
+	d = newFakeDocker(t)
+	_, stderr, exit = d.Fugu("", append(args, "--wait-timeout=5")...)
+	assert.Equal(t, 1, exit)
+	assert.Contains(t, stderr, "flag provided but not defined: --wait-timeout")
+	d.Close()
+
+	// stop-first frees fixed host ports and starts the old container on rollback
+	fixedArgs := []string{"deploy", "--image=nginx", "--name=web", "--publish=8080:80", "--stop-first"}
+	fixedRunArgv := []string{"run", "--detach", "--label=fugu.hash=e761ef8cdf08", "--name=web-fugu-next", "--publish=8080:80", "nginx"}
+	d = newFakeDocker(t)
+	d.Respond("inspect --type=container web-fugu-next", noSuch, exited)
+	d.Respond("inspect --type=container web", old)
+	_, stderr, exit = d.Fugu("", fixedArgs...)
+	assert.Equal(t, 1, exit)
+	assert.Contains(t, stderr, "Error: deploy failed, the old container is still running\n")
+	assert.Equal(t, [][]string{
+		{"inspect", "--type=container", "web-fugu-next"},
+		{"inspect", "--type=container", "web"},
+		{"stop", "web"},
+		fixedRunArgv,
+		{"inspect", "--type=container", "web-fugu-next"},
+		{"logs", "--tail=10", "web-fugu-next"},
+		{"rm", "--force", "web-fugu-next"},
+		{"start", "web"},
+	}, d.Argvs())
+	d.Close()
+
+	d = newFakeDocker(t)
+	d.Respond("inspect --type=container web-fugu-next", noSuch, fakeResponse{Stdout: `[{"Name": "/web-fugu-next", "State": {"Running": true}}]`})
+	d.Respond("inspect --type=container web", old)
+	stdout, stderr, exit = d.Fugu("", fixedArgs...)
+	assert.Equal(t, 0, exit, stderr)
+	assert.Equal(t, "docker stop web\n"+strings.Join(append([]string{"docker"}, fixedRunArgv...), " ")+"\n"+
+		"docker rm --force web\ndocker rename web-fugu-next web\nweb: deployed\n", stdout)
+	d.Close()
+}
+
+func TestMainRunWaitFor(t *testing.T) {
+	running := fakeResponse{Stdout: `[{"Name": "/web", "State": {"Running": true}}]`}
+	args := []string{"run", "--image=nginx", "--name=web", "--detach", "--wait-for-log=^ready"}
+
+	// log line appears
+	d := newFakeDocker(t)
+	d.Respond("inspect --type=container web", running)
+	d.Respond("logs", fakeResponse{Stdout: "starting\n"}, fakeResponse{Stdout: "starting\nready\n"})
+	_, stderr, exit := d.Fugu("", args...)
+	assert.Equal(t, 0, exit, stderr)
+	assert.Equal(t, [][]string{
+		{"run", "--detach", "--label=fugu.hash=a05eae9da2ff", "--name=web", "nginx"},
+		{"inspect", "--type=container", "web"},
+		{"logs", "--tail=all", "web"},
+		{"inspect", "--type=container", "web"},
+		{"logs", "--tail=all", "web"},
+	}, d.Argvs())
+	d.Close()
+
+	// times out with the last log lines
+	d = newFakeDocker(t)
+	d.Respond("inspect --type=container web", running)
+	d.Respond("logs", fakeResponse{Stdout: "starting\n"})
+	_, stderr, exit = d.Fugu("", append(args, "--wait-timeout=0")...)
+	assert.Equal(t, 1, exit)
+	assert.Equal(t, "wait: container web not ready after 0s\n"+
+		"last log lines of web:\nstarting\n"+
+		"Error: container did not get ready\n", stderr)
+	d.Close()
+
+	// nothing to wait for, nothing is run
+	d = newFakeDocker(t)
+	_, stderr, exit = d.Fugu("", "run", "--image=nginx", "--name=web", "--wait-for-log=^ready")
+	assert.Equal(t, 1, exit)
+	assert.Equal(t, "Error: wait-for options need --detach\n", stderr)
+	_, stderr, exit = d.Fugu("", "run", "--image=nginx", "--detach", "--wait-for-log=^ready")
+	assert.Equal(t, 1, exit)
+	assert.Equal(t, "Error: wait-for options need a name\n", stderr)
+	assert.Empty(t, d.Calls())
+	d.Close()
+}
+
+func TestMainMultiLabel(t *testing.T) {
+	d := newFakeDocker(t)
+	defer d.Close()
+
+	stdout, stderr, exit := d.Fugu("", "destroy", "--all", "--source=file://../examples/fugu.labels.yml", "--parallel=1")
+	assert.Equal(t, 0, exit, stderr)
+	assert.Equal(t, `label1 | docker rm --force my-redis
+label2 | docker rm --force another-ubuntu
+
+LABEL   RESULT
+label1  ok
+label2  ok
+`, stdout)
+	assert.Equal(t, [][]string{
+		{"rm", "--force", "my-redis"},
+		{"rm", "--force", "another-ubuntu"},
+	}, d.Argvs())
+
+	d.Respond("rm --force another-ubuntu", fakeResponse{Stderr: "No such container\n", Exit: 1})
+	stdout, stderr, exit = d.Fugu("", "destroy", "label2,label1", "--source=file://../examples/fugu.labels.yml")
+	assert.Equal(t, 1, exit)
+	assert.Contains(t, stdout, "label2  failed, exit status 1\nlabel1  ok\n")
+	assert.Equal(t, "label2 | No such container\nError: command failed for some labels\n", stderr)
+
+	// no label list, label3 is unknown
+	_, stderr, exit = d.Fugu("", "destroy", "label1,label3", "--source=file://../examples/fugu.labels.yml")
+	assert.Equal(t, 1, exit)
+	assert.Equal(t, "Error: too many arguments given\n", stderr)
+
+	// interactive commands run for one label
+	stdout, stderr, exit = d.Fugu("", "exec", "a,b", "--source=file://../examples/fugu.labels.yml", "--dry-run")
+	assert.Equal(t, 0, exit, stderr)
+	assert.Equal(t, "docker exec my-redis a,b\n", stdout)
+
+	_, stderr, exit = d.Fugu("", "shell", "--all", "--source=file://../examples/fugu.labels.yml")
+	assert.Equal(t, 1, exit)
+	assert.Contains(t, stderr, "flag provided but not defined: --all")
+
+	_, stderr, exit = d.Fugu("", "pull", "--labels=api-*", "--source=file://../examples/fugu.labels.yml")
+	assert.Equal(t, 1, exit)
+	assert.Equal(t, "Error: no label selected\n", stderr)
+}
+
+func TestMainGroup(t *testing.T) {
+	d := newFakeDocker(t)
+	defer d.Close()
+
+	stdout, stderr, exit := d.Fugu("", "destroy", "backend", "--source=file://../examples/fugu.groups.yml", "--parallel=1")
+	assert.Equal(t, 0, exit, stderr)
+	assert.Contains(t, stdout, "LABEL   RESULT\napp     ok\nworker  ok\nredis   ok\n")
+	assert.Equal(t, [][]string{
+		{"rm", "--force", "my-app"},
+		{"rm", "--force", "my-worker"},
+		{"rm", "--force", "my-redis"},
+	}, d.Argvs())
+
+	d.Respond("run", fakeResponse{Stderr: "port is already allocated\n", Exit: 125})
+	stdout, stderr, exit = d.Fugu("", "run", "backend", "--source=file://../examples/fugu.groups.yml")
+	assert.Equal(t, 1, exit)
+	assert.Contains(t, stdout, "LABEL   RESULT\nredis   failed, exit status 125\napp     skipped, redis failed\nworker  skipped, redis failed\n")
+	assert.Equal(t, "redis  | port is already allocated\nError: command failed for some labels\n", stderr)
+	assert.Len(t, d.Argvs(), 4)
+}
+
+func TestMainPlugin(t *testing.T) {
+	d := newFakeDocker(t)
+	defer d.Close()
+
+	plugin := `#!/bin/sh
+echo "args: $*"
+echo "$FUGU_CURRENT_LABEL $FUGU_IMAGE $FUGU_NAME"
+cat "$FUGU_DATA_FILE"
+exit 3
+`
+	if err := ioutil.WriteFile(filepath.Join(d.dir, "fugu-seed"), []byte(plugin), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, exit := d.Fugu("", "seed", "label1", "--source=file://../examples/fugu.labels.yml", "--force", "db")
+	assert.Equal(t, 3, exit, stderr)
+	assert.Equal(t, "args: --force db\nlabel1 redis my-redis\n{\"image\":\"redis\",\"name\":\"my-redis\"}\n", stdout)
+
+	stdout, _, exit = d.Fugu("", "seed", "label1,label2", "--source=file://../examples/fugu.labels.yml")
+	assert.Equal(t, 1, exit)
+	assert.Contains(t, stdout, "label1 | label1 redis my-redis\n")
+	assert.Contains(t, stdout, "label2 | label2  another-ubuntu\n")
+	assert.Contains(t, stdout, "LABEL   RESULT\nlabel1  failed, exit status 3\n")
+
+	_, stderr, exit = d.Fugu("", "help")
+	assert.Equal(t, 0, exit)
+	assert.Contains(t, stderr, "\nPlugins:\n    seed ")
+
+	stdout, _, _ = d.Fugu("", "__complete", "se")
+	assert.Equal(t, "seed\n", stdout)
+
+	_, stderr, exit = d.Fugu("", "bogus")
+	assert.Equal(t, 1, exit)
+	assert.Contains(t, stderr, "Error: unkown command\n")
+}
+
+func TestMainHooks(t *testing.T) {
+	d := newFakeDocker(t)
+	defer d.Close()
+
+	config := `
+app:
+  image: foo
+  name: my-app
+  pre-run: echo "pre ${FUGU_NAME} ${FUGU_CURRENT_LABEL}"
+  post-run: [echo post1, echo post2]
+  pre-destroy: exit 3
+`
+	source := filepath.Join(d.dir, "fugu.yml")
+	if err := ioutil.WriteFile(source, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, exit := d.Fugu("", "run", "app", "--source=file://"+source)
+	assert.Equal(t, 0, exit, stderr)
+	assert.Equal(t, "pre my-app app\ndocker run --label=fugu.hash=69035b12f77b --name=my-app foo\npost1\npost2\n", stdout)
+	assert.Len(t, d.Argvs(), 1)
+
+	stdout, _, exit = d.Fugu("", "run", "app", "--source=file://"+source, "--dry-run")
+	assert.Equal(t, 0, exit)
+	assert.Equal(t, "sh -c 'echo \"pre ${FUGU_NAME} ${FUGU_CURRENT_LABEL}\"'\ndocker run --label=fugu.hash=69035b12f77b --name=my-app foo\nsh -c 'echo post1'\nsh -c 'echo post2'\n", stdout)
+
+	// failing pre hooks stop the command
+	_, stderr, exit = d.Fugu("", "destroy", "app", "--source=file://"+source)
+	assert.Equal(t, 1, exit)
+	assert.Equal(t, "Error: pre-destroy hook failed: exit status 3\n", stderr)
+	assert.Len(t, d.Argvs(), 1)
+}
+
+func TestMainEnvSource(t *testing.T) {
+	d := newFakeDocker(t)
+	defer d.Close()
+	d.Env = []string{"FUGU_IMAGE=env-image", "FUGU_PUBLISH_0=80", "FUGU_LABEL1__NAME=env-name"}
+
+	stdout, stderr, exit := d.Fugu("", "show-data", "label1", "--source=file://../examples/fugu.labels.yml", "--origin")
+	assert.Equal(t, 0, exit, stderr)
+	assert.Equal(t, "image: env-image # env://\nname: env-name # env://\npublish: \"80\" # env://\n", stdout)
+
+	// env overwrites files, args overwrite env
+	d.Fugu("", "run", "label2", "--source=file://../examples/fugu.labels.yml", "--publish=443")
+	argvs := d.Argvs()
+	if assert.Len(t, argvs, 1) {
+		assert.Contains(t, argvs[0], "--name=another-ubuntu")
+		assert.Contains(t, argvs[0], "--publish=443")
+		assert.Contains(t, argvs[0], "env-image")
+	}
+}
+
+func TestMainEnvSourceInPlugin(t *testing.T) {
+	d := newFakeDocker(t)
+	defer d.Close()
+
+	// a plugin for label2 runs fugu for label1, the data of label2
+	// is skipped, the vars of the user are not
+	d.Env = []string{"FUGU_CURRENT_LABEL=label2", "FUGU_DATA_VARS=FUGU_IMAGE FUGU_NAME",
+		"FUGU_IMAGE=ubuntu", "FUGU_NAME=another-ubuntu", "FUGU_LABEL1__NAME=env-name", "FUGU_PUBLISH_0=80"}
+
+	stdout, stderr, exit := d.Fugu("", "show-data", "label1", "--source=file://../examples/fugu.labels.yml", "--origin")
+	assert.Equal(t, 0, exit, stderr)
+	assert.Equal(t, "image: redis # file://../examples/fugu.labels.yml\nname: env-name # env://\npublish: \"80\" # env://\n", stdout)
+}
+
+func TestMainHttpSource(t *testing.T) {
+	d := newFakeDocker(t)
+	defer d.Close()
+
+	home, err := ioutil.TempDir("", "fugu-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	d.Env = []string{"HOME=" + home}
+
+	ts := httptest.NewServer(http.FileServer(http.Dir("../examples")))
+	source := "--source=" + ts.URL + "/fugu.labels.yml"
+
+	stdout, stderr, exit := d.Fugu("", "show-labels", source)
+	assert.Equal(t, 0, exit, stderr)
+	assert.Equal(t, "label1\nlabel2\n", stdout)
+
+	// the cached copy is used while offline
+	ts.Close()
+	stdout, stderr, exit = d.Fugu("", "show-data", "label2", source)
+	assert.Equal(t, 0, exit, stderr)
+	assert.Contains(t, stdout, "name: another-ubuntu")
+	assert.Contains(t, stderr, "using cached copy")
+
+	files, _ := ioutil.ReadDir(filepath.Join(home, ".cache/fugu"))
+	assert.Len(t, files, 2)
+}
+
+func TestMainCompletion(t *testing.T) {
+	d := newFakeDocker(t)
+	defer d.Close()
+
+	stdout, _, exit := d.Fugu("", "__complete", "run", "--source=file://../examples/fugu.labels.yml", "")
+	assert.Equal(t, 0, exit)
+	assert.Equal(t, "label1\nlabel2\n", stdout)
+
+	stdout, _, exit = d.Fugu("", "completion", "zsh")
+	assert.Equal(t, 0, exit)
+	assert.Contains(t, stdout, "compdef _fugu fugu")
+
+	_, stderr, exit := d.Fugu("", "completion", "tcsh")
+	assert.Equal(t, 1, exit)
+	assert.Equal(t, "Error: unknown shell, use bash, zsh or fish\n", stderr)
+}
+
+func TestMainCompletionBash(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is missing")
+	}
+	d := newFakeDocker(t)
+	defer d.Close()
+	if err := os.Symlink(os.Args[0], filepath.Join(d.dir, "fugu")); err != nil {
+		t.Fatal(err)
+	}
+
+	// complete runs _fugu like bash does for the line typed so far
+	complete := func(line string) string {
+		cmd := exec.Command("bash", "-c", fugu.CompletionScripts["bash"]+`
+COMP_LINE="$1" COMP_POINT=${#1}
+_fugu
+printf '%s\n' "${COMPREPLY[@]}"`, "bash", line)
+		cmd.Env = []string{"RUN_FUGU_MAIN=1", "PATH=" + d.dir + string(os.PathListSeparator) + os.Getenv("PATH")}
+		out, err := cmd.CombinedOutput()
+		assert.NoError(t, err, string(out))
+		return string(out)
+	}
+
+	assert.Equal(t, "label1\nlabel2\n", complete("fugu run --source=file://../examples/fugu.labels.yml "))
+	assert.Equal(t, "label2\n", complete("fugu run --source=file://../examples/fugu.labels.yml label2"))
+	assert.Contains(t, complete("fugu run --source=file://../examples/fugu.labels.yml --dry"), "--dry-run\n")
+}
+
+func TestMainHelp(t *testing.T) {
+	d := newFakeDocker(t)
+	defer d.Close()
+
+	_, stderr, exit := d.Fugu("", "help", "stop")
+	assert.Equal(t, 0, exit)
+	assert.Contains(t, stderr, "Usage: fugu stop [LABEL] [OPTIONS]\n\nStop a running container\n")
+	assert.Contains(t, stderr, "Docker options:\n  -t, --time=10")
+
+	_, stderr, exit = d.Fugu("", "stop", "--help")
+	assert.Equal(t, 0, exit)
+	assert.Contains(t, stderr, "Usage: fugu stop [LABEL] [OPTIONS]\n")
+
+	stdout, _, exit := d.Fugu("", "man")
+	assert.Equal(t, 0, exit)
+	assert.Contains(t, stdout, ".TH FUGU 1 \"\" \"fugu "+fugu.Version+"\"")
+}
@@ -1,3 +0,0 @@
-package main
-
-const Version = "1.1.1"
@@ -1,12 +1,18 @@
 package fugu
 
 import (
+	"bytes"
+	"fmt"
+	"github.com/docker/docker/nat"
 	"github.com/mattes/go-collect"
+	"github.com/mattes/go-collect/data"
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
 	"os"
 	"os/user"
+	"path/filepath"
 	"testing"
+	"time"
 
 	fileSource "github.com/mattes/go-collect/source/file"
 )
@@ -36,10 +42,10 @@ func (dct *DockerCommandTest) Test(t *testing.T) {
 	data, remainingArgs, err := c.Parse(dct.argsIn, FuguFlags[dct.command], DockerFlags[dct.command])
 	assert.NoError(t, err, dct.testDesc)
 	if err == nil {
-		str, err := DockerCommands[dct.command](c, data, remainingArgs)
+		cmd, err := Lookup(dct.command).Docker(c, data, remainingArgs)
 		assert.Equal(t, dct.errOut, err, dct.testDesc)
 		if err == nil {
-			assert.Equal(t, dct.strOut, str, dct.testDesc)
+			assert.Equal(t, dct.strOut, cmd.String(), dct.testDesc)
 		}
 	}
 }
@@ -67,7 +73,7 @@ func (dct *CommandTest) Test(t *testing.T) {
 		r, w, _ := os.Pipe()
 		os.Stdout = w
 
-		err = Commands[dct.command](c, data, remainingArgs)
+		err = Lookup(dct.command).Run(c, data, remainingArgs)
 
 		w.Close()
 		out, _ := ioutil.ReadAll(r)
@@ -224,7 +230,7 @@ func TestCommandRun(t *testing.T) {
 		testDesc: "plain run with label",
 		command:  "run",
 		argsIn:   []string{"label1", "--source=file://examples/fugu.labels.yml"},
-		strOut:   "docker run --name=my-redis redis",
+		strOut:   "docker run --label=fugu.hash=006abedb93ff --name=my-redis redis",
 		errOut:   nil,
 	}).Test(t)
 
@@ -232,7 +238,7 @@ func TestCommandRun(t *testing.T) {
 		testDesc: "plain run without label",
 		command:  "run",
 		argsIn:   []string{"--source=file://examples/fugu.simple.yml"},
-		strOut:   "docker run --name=my-ubuntu ubuntu",
+		strOut:   "docker run --label=fugu.hash=3120465c0e05 --name=my-ubuntu ubuntu",
 		errOut:   nil,
 	}).Test(t)
 
@@ -240,7 +246,7 @@ func TestCommandRun(t *testing.T) {
 		testDesc: "plain run with unknown label",
 		command:  "run",
 		argsIn:   []string{"label-unknown", "--source=file://examples/fugu.labels.yml"},
-		strOut:   "docker run --name=my-redis redis label-unknown",
+		strOut:   "docker run --label=fugu.hash=6c2c79944886 --name=my-redis redis label-unknown",
 		errOut:   nil,
 	}).Test(t)
 
@@ -264,7 +270,7 @@ func TestCommandRun(t *testing.T) {
 		testDesc: "get docker command from args (with label)",
 		command:  "run",
 		argsIn:   []string{"--image=foo", "--source=file://examples/fugu.labels.yml", "cmd"},
-		strOut:   "docker run --name=my-redis foo cmd",
+		strOut:   "docker run --label=fugu.hash=5b7f11f42556 --name=my-redis foo cmd",
 		errOut:   nil,
 	}).Test(t)
 
@@ -272,7 +278,7 @@ func TestCommandRun(t *testing.T) {
 		testDesc: "get docker command from args (without label)",
 		command:  "run",
 		argsIn:   []string{"--image=foo", "--source=file://examples/fugu.simple.yml", "cmd"},
-		strOut:   "docker run --name=my-ubuntu foo cmd",
+		strOut:   "docker run --label=fugu.hash=2458d9dfde59 --name=my-ubuntu foo cmd",
 		errOut:   nil,
 	}).Test(t)
 
@@ -280,7 +286,7 @@ func TestCommandRun(t *testing.T) {
 		testDesc: "get docker command from args (without label) 2",
 		command:  "run",
 		argsIn:   []string{"--source=file://examples/fugu.simple.yml", "cmd"},
-		strOut:   "docker run --name=my-ubuntu ubuntu cmd",
+		strOut:   "docker run --label=fugu.hash=a3298cc85c74 --name=my-ubuntu ubuntu cmd",
 		errOut:   nil,
 	}).Test(t)
 
@@ -344,7 +350,7 @@ func TestCommandRun(t *testing.T) {
 		testDesc: "args given via args and flags (with label)",
 		command:  "run",
 		argsIn:   []string{"--image=foo", "--source=file://examples/fugu.labels.yml", "--arg=c", "--arg=d", "--arg=e", "a", "b"},
-		strOut:   "docker run --name=my-redis foo a b",
+		strOut:   "docker run --label=fugu.hash=90942b25e168 --name=my-redis foo a b",
 		errOut:   nil,
 	}).Test(t)
 
@@ -357,7 +363,7 @@ func TestCommandRun(t *testing.T) {
 		testDesc: "command with volume flag",
 		command:  "run",
 		argsIn:   []string{"--image=foo", "--source=file://examples/fugu.volumes.yml"},
-		strOut:   "docker run --name=my-ubuntu --volume=" + usr.HomeDir + "/Go:/root/Go --volume=/tmp foo",
+		strOut:   "docker run --label=fugu.hash=273786fbc34b --name=my-ubuntu --volume=" + usr.HomeDir + "/Go:/root/Go --volume=/tmp foo",
 		errOut:   nil,
 	}).Test(t)
 
@@ -365,11 +371,50 @@ func TestCommandRun(t *testing.T) {
 		testDesc: "command with log-driver and log-opt flag",
 		command:  "run",
 		argsIn:   []string{"--image=foo", "--source=file://examples/fugu.log-driver.yml"},
-		strOut:   "docker run --log-driver=syslog --log-opt=syslog-address=tcp://192.168.0.42:123 --name=my-ubuntu foo",
+		strOut:   "docker run --label=fugu.hash=bb10a4bd2f90 --log-driver=syslog --log-opt=syslog-address=tcp://192.168.0.42:123 --name=my-ubuntu foo",
 		errOut:   nil,
 	}).Test(t)
 }
 
+func TestCommandRunReplace(t *testing.T) {
+	(&DockerCommandTest{
+		testDesc: "replace needs a name",
+		command:  "run",
+		argsIn:   []string{"--image=foo", "--replace"},
+		strOut:   "",
+		errOut:   ErrMissingName,
+	}).Test(t)
+
+	(&DockerCommandTest{
+		testDesc: "replace is not passed to docker",
+		command:  "run",
+		argsIn:   []string{"--image=foo", "--name=bar", "--replace", "--replace-timeout=3"},
+		strOut:   "docker run --label=fugu.hash=428a813a4e45 --name=bar foo",
+		errOut:   nil,
+	}).Test(t)
+}
+
+func TestCmdQuoting(t *testing.T) {
+	c := collect.New()
+	data, remainingArgs, err := c.Parse([]string{"--image=foo", "--env=A=$HOME `id`", "--name=it's", "sh", "-c", "echo \"$A\""}, FuguFlags["run"], DockerFlags["run"])
+	assert.NoError(t, err)
+
+	cmd, err := cmdRun(c, data, remainingArgs)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// argv is passed to docker as is
+	assert.Equal(t, []string{"docker", "run", "--env=A=$HOME `id`", "--label=fugu.hash=e7c071d2bb2a", "--name=it's", "foo", "sh", "-c", "echo \"$A\""}, cmd.Argv())
+
+	// string is safe to paste into a shell
+	assert.Equal(t, "docker run --env='A=$HOME `id`' --label=fugu.hash=e7c071d2bb2a --name='it'\\''s' foo sh -c 'echo \"$A\"'", cmd.String())
+
+	assert.Equal(t, "''", shellQuote(""))
+	assert.Equal(t, `'it'\''s'`, shellQuote("it's"))
+	assert.Equal(t, "--detach", dockerOpt("detach", "true"))
+}
+
 func TestCommandExec(t *testing.T) {
 	(&DockerCommandTest{
 		testDesc: "name is missing",
@@ -531,7 +576,7 @@ func TestCommandDestroy(t *testing.T) {
 		testDesc: "plain destroy",
 		command:  "destroy",
 		argsIn:   []string{"--name=foo"},
-		strOut:   "docker rm -f foo",
+		strOut:   "docker rm --force foo",
 		errOut:   nil,
 	}).Test(t)
 
@@ -539,7 +584,7 @@ func TestCommandDestroy(t *testing.T) {
 		testDesc: "plain destroy with label",
 		command:  "destroy",
 		argsIn:   []string{"label1", "--source=file://examples/fugu.labels.yml"},
-		strOut:   "docker rm -f my-redis",
+		strOut:   "docker rm --force my-redis",
 		errOut:   nil,
 	}).Test(t)
 
@@ -560,6 +605,310 @@ func TestCommandDestroy(t *testing.T) {
 	}).Test(t)
 }
 
+func TestCommandLogs(t *testing.T) {
+	(&DockerCommandTest{
+		testDesc: "name is missing",
+		command:  "logs",
+		argsIn:   []string{},
+		strOut:   "",
+		errOut:   ErrMissingName,
+	}).Test(t)
+
+	(&DockerCommandTest{
+		testDesc: "plain logs",
+		command:  "logs",
+		argsIn:   []string{"--name=foo"},
+		strOut:   "docker logs foo",
+		errOut:   nil,
+	}).Test(t)
+
+	(&DockerCommandTest{
+		testDesc: "plain logs with label",
+		command:  "logs",
+		argsIn:   []string{"label1", "--source=file://examples/fugu.labels.yml"},
+		strOut:   "docker logs my-redis",
+		errOut:   nil,
+	}).Test(t)
+
+	(&DockerCommandTest{
+		testDesc: "logs with options",
+		command:  "logs",
+		argsIn:   []string{"--name=foo", "--follow", "--tail=10", "--since=42m", "--timestamps"},
+		strOut:   "docker logs --follow --since=42m --tail=10 --timestamps foo",
+		errOut:   nil,
+	}).Test(t)
+
+	(&DockerCommandTest{
+		testDesc: "plain logs with unknown label",
+		command:  "logs",
+		argsIn:   []string{"label-unknown", "--source=file://examples/fugu.labels.yml"},
+		strOut:   "",
+		errOut:   ErrTooManyArgs,
+	}).Test(t)
+}
+
+func TestCommandLifecycle(t *testing.T) {
+	for _, command := range []string{"start", "stop", "restart", "kill", "pause", "unpause"} {
+		(&DockerCommandTest{
+			testDesc: "name is missing",
+			command:  command,
+			argsIn:   []string{},
+			strOut:   "",
+			errOut:   ErrMissingName,
+		}).Test(t)
+
+		(&DockerCommandTest{
+			testDesc: "plain " + command,
+			command:  command,
+			argsIn:   []string{"--name=foo"},
+			strOut:   "docker " + command + " foo",
+			errOut:   nil,
+		}).Test(t)
+
+		(&DockerCommandTest{
+			testDesc: "plain " + command + " with label",
+			command:  command,
+			argsIn:   []string{"label1", "--source=file://examples/fugu.labels.yml"},
+			strOut:   "docker " + command + " my-redis",
+			errOut:   nil,
+		}).Test(t)
+
+		(&DockerCommandTest{
+			testDesc: "plain " + command + " with unknown label",
+			command:  command,
+			argsIn:   []string{"label-unknown", "--source=file://examples/fugu.labels.yml"},
+			strOut:   "",
+			errOut:   ErrTooManyArgs,
+		}).Test(t)
+	}
+
+	(&DockerCommandTest{
+		testDesc: "stop with time",
+		command:  "stop",
+		argsIn:   []string{"--name=foo", "--time=3"},
+		strOut:   "docker stop --time=3 foo",
+		errOut:   nil,
+	}).Test(t)
+
+	(&DockerCommandTest{
+		testDesc: "kill with signal",
+		command:  "kill",
+		argsIn:   []string{"--name=foo", "-s", "HUP"},
+		strOut:   "docker kill --signal=HUP foo",
+		errOut:   nil,
+	}).Test(t)
+
+	(&DockerCommandTest{
+		testDesc: "start attached",
+		command:  "start",
+		argsIn:   []string{"--name=foo", "-a", "-i"},
+		strOut:   "docker start --attach --interactive foo",
+		errOut:   nil,
+	}).Test(t)
+}
+
+type fakeInspector struct {
+	containers map[string]*containerJSON
+	images     map[string]*imageJSON
+	logs       map[string]string
+}
+
+func (i *fakeInspector) inspectContainer(name string) (*containerJSON, error) {
+	return i.containers[name], nil
+}
+
+func (i *fakeInspector) inspectImage(image string) (*imageJSON, error) {
+	return i.images[image], nil
+}
+
+func (i *fakeInspector) containerLogs(name, tail string) (string, error) {
+	return i.logs[name], nil
+}
+
+func TestContainerStatus(t *testing.T) {
+	now := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	running := &containerJSON{Name: "/my-redis", Image: "a1b2c3d4e5f6a7b8"}
+	running.State.Running = true
+	running.State.StartedAt = now.Add(-3 * time.Hour)
+	running.NetworkSettings.Ports = map[string][]struct {
+		HostIp   string
+		HostPort string
+	}{
+		"6379/tcp": {{HostIp: "0.0.0.0", HostPort: "6379"}},
+		"8080/tcp": {},
+	}
+	exited := &containerJSON{Name: "/old", Image: "0000"}
+	exited.State.ExitCode = 137
+	exited.State.StartedAt = now.Add(-time.Hour)
+	created := &containerJSON{Name: "/new", Image: "0000"}
+	created.State.Status = "created"
+	ins := &fakeInspector{
+		containers: map[string]*containerJSON{"my-redis": running, "old": exited, "new": created},
+		images:     map[string]*imageJSON{"redis": {Id: "a1b2c3d4e5f6a7b8"}},
+	}
+
+	statuses := make([]*ContainerStatus, 0)
+	for _, p := range []*data.Data{
+		data.New().Set("name", "my-redis").Set("image", "redis"),
+		data.New().Set("name", "old").Set("image", "redis"),
+		data.New().Set("name", "missing"),
+		data.New(),
+	} {
+		s, err := containerStatus(ins, "label", p, now)
+		assert.NoError(t, err)
+		statuses = append(statuses, s)
+	}
+
+	assert.Equal(t, "running", statuses[0].State)
+	assert.Equal(t, "3 hours", statuses[0].Uptime)
+	assert.Equal(t, []string{"0.0.0.0:6379->6379/tcp"}, statuses[0].Ports)
+	assert.True(t, statuses[0].ImageCurrent)
+	assert.Equal(t, "exited", statuses[1].State)
+	assert.False(t, statuses[1].ImageCurrent)
+
+	// created but never started, with and without State.Status
+	s, err := containerStatus(ins, "label", data.New().Set("name", "new"), now)
+	assert.NoError(t, err)
+	assert.Equal(t, "created", s.State)
+	created.State.Status = ""
+	s, err = containerStatus(ins, "label", data.New().Set("name", "new"), now)
+	assert.NoError(t, err)
+	assert.Equal(t, "created", s.State)
+
+	assert.False(t, statuses[2].Exists)
+	assert.Equal(t, "unnamed", statuses[3].State)
+
+	out := &bytes.Buffer{}
+	assert.NoError(t, writeStatus(out, statuses, false))
+	assert.Equal(t, `LABEL  NAME      STATE    UPTIME   EXIT CODE  IMAGE ID      IMAGE CURRENT  PORTS
+label  my-redis  running  3 hours  0          a1b2c3d4e5f6  yes            0.0.0.0:6379->6379/tcp
+label  old       exited   -        137        0000          no             -
+label  missing   missing  -        -          -             -              -
+label  -         unnamed  -        -          -             -              -
+`, out.String())
+
+	out.Reset()
+	assert.NoError(t, writeStatus(out, statuses[2:3], true))
+	assert.Equal(t, `[
+  {
+    "label": "label",
+    "name": "missing",
+    "exists": false,
+    "state": "missing",
+    "exit_code": 0,
+    "ports": [],
+    "image_current": false
+  }
+]
+`, out.String())
+}
+
+func TestStatus(t *testing.T) {
+	(&CommandTest{
+		testDesc:       "status: name is missing",
+		command:        "status",
+		argsIn:         []string{},
+		errOut:         ErrMissingName,
+		stdoutContains: []string{},
+	}).Test(t)
+
+	(&CommandTest{
+		testDesc:       "status: invalid number of args",
+		command:        "status",
+		argsIn:         []string{"label1", "bogus", "--source=file://examples/fugu.labels.yml"},
+		errOut:         ErrTooManyArgs,
+		stdoutContains: []string{},
+	}).Test(t)
+
+	(&CommandTest{
+		testDesc:       "status: unknown backend",
+		command:        "status",
+		argsIn:         []string{"--name=foo", "--backend=bogus"},
+		errOut:         ErrUnknownBackend,
+		stdoutContains: []string{},
+	}).Test(t)
+}
+
+func TestConfigHash(t *testing.T) {
+	(&DockerCommandTest{
+		testDesc: "run replaces hash label",
+		command:  "run",
+		argsIn:   []string{"--image=foo", "--name=bar", "--label=a=b", "--label=fugu.hash=stale"},
+		strOut:   "docker run --label=a=b --label=fugu.hash=35dbf0f437be --name=bar foo",
+		errOut:   nil,
+	}).Test(t)
+
+	(&DockerCommandTest{
+		testDesc: "run hash ignores detach",
+		command:  "run",
+		argsIn:   []string{"--image=foo", "--name=bar", "--label=a=b", "--detach", "--rm"},
+		strOut:   "docker run --detach --label=a=b --label=fugu.hash=35dbf0f437be --name=bar --rm foo",
+		errOut:   nil,
+	}).Test(t)
+}
+
+func TestConfigDiff(t *testing.T) {
+	cmd := testCmd(t, "run", "--image=redis", "--name=my-redis", "--env=A=2", "--env=B=1",
+		"--publish=127.0.0.1:6379:6379", "--volume=/data:/data", "--restart=always", "--label=team=x")
+
+	container := &containerJSON{Name: "/my-redis", Image: "0000"}
+	container.Config.Image = "redis"
+	container.Config.Cmd = []string{"redis-server"}
+	container.Config.Env = []string{"A=1", "B=1", "PATH=/bin"}
+	container.Config.Labels = map[string]string{"team": "x", ConfigHashLabel: "stale"}
+	container.HostConfig.Binds = []string{"/data:/data"}
+	container.HostConfig.RestartPolicy.Name = "always"
+	haveImage := &imageJSON{Id: "0000"}
+	haveImage.Config.Env = []string{"PATH=/bin"}
+	haveImage.Config.Cmd = []string{"redis-server"}
+	wantImage := &imageJSON{Id: "1111"}
+	wantImage.Config.Env = []string{"PATH=/bin"}
+	wantImage.Config.Cmd = []string{"redis-server"}
+
+	diffs, err := configDiff(container, haveImage, cmd, wantImage)
+	assert.NoError(t, err)
+	out := &bytes.Buffer{}
+	writeDiff(out, diffs)
+	assert.Equal(t, `env
+  - A=1
+  + A=2
+publish
+  + 127.0.0.1:6379->6379/tcp
+fugu.hash
+  - stale
+  + `+cmd.Flags.GetAll("label")[1][len(ConfigHashLabel)+1:]+`
+image id
+  - 0000
+  + 1111
+`, out.String())
+
+	container.Config.Env = []string{"A=2", "B=1", "PATH=/bin"}
+	container.HostConfig.PortBindings = nat.PortMap{"6379/tcp": {{HostIp: "127.0.0.1", HostPort: "6379"}}}
+	container.Config.Labels[ConfigHashLabel] = cmd.Flags.GetAll("label")[1][len(ConfigHashLabel)+1:]
+	container.Image = "1111"
+	diffs, err = configDiff(container, haveImage, cmd, wantImage)
+	assert.NoError(t, err)
+	assert.Empty(t, diffs)
+}
+
+func TestUp(t *testing.T) {
+	(&CommandTest{
+		testDesc:       "up: name is missing",
+		command:        "up",
+		argsIn:         []string{"--image=foo"},
+		errOut:         ErrMissingName,
+		stdoutContains: []string{},
+	}).Test(t)
+
+	(&CommandTest{
+		testDesc:       "up: image is missing",
+		command:        "up",
+		argsIn:         []string{"--name=foo"},
+		errOut:         ErrMissingImage,
+		stdoutContains: []string{},
+	}).Test(t)
+}
+
 func TestCommandPush(t *testing.T) {
 	(&DockerCommandTest{
 		testDesc: "name is missing",
@@ -719,6 +1068,22 @@ func TestShowLabels(t *testing.T) {
 		stdoutContains: []string{"label1", "label2"},
 	}).Test(t)
 
+	(&CommandTest{
+		testDesc:       "show-labels from toml",
+		command:        "show-labels",
+		argsIn:         []string{"--source=file://examples/fugu.labels.toml"},
+		errOut:         nil,
+		stdoutContains: []string{"label1\nlabel2\n"},
+	}).Test(t)
+
+	(&CommandTest{
+		testDesc:       "show-labels from json",
+		command:        "show-labels",
+		argsIn:         []string{"--source=file://examples/fugu.labels.json"},
+		errOut:         nil,
+		stdoutContains: []string{"label1\nlabel2\n"},
+	}).Test(t)
+
 	(&CommandTest{
 		testDesc:       "show-labels: invalid number of args",
 		command:        "show-labels",
@@ -736,6 +1101,151 @@ func TestShowLabels(t *testing.T) {
 	}).Test(t)
 }
 
+func TestResolveExecutable(t *testing.T) {
+	assert.True(t, filepath.IsAbs(executable), executable)
+	_, err := os.Stat(executable)
+	assert.NoError(t, err)
+}
+
+// parsed returns a collector that parsed args like Command.Exec
+func parsed(t *testing.T, args ...string) *collect.Collector {
+	c := collect.New()
+	if _, _, err := c.Parse(args, FuguFlags["run"], DockerFlags["run"]); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestParseMultiLabel(t *testing.T) {
+	source := "--source=file://examples/fugu.labels.yml"
+	parse := func(args ...string) (*MultiLabel, error) {
+		return ParseMultiLabel(parsed(t, args...), args)
+	}
+
+	m, err := parse("label1", source)
+	assert.NoError(t, err)
+	assert.Nil(t, m)
+
+	m, err = parse("label2,label1", source, "--detach")
+	assert.NoError(t, err)
+	assert.Equal(t, &MultiLabel{
+		Labels:    []string{"label2", "label1"},
+		Parallel:  DefaultParallel,
+		Args:      []string{source, "--detach"},
+		DependsOn: map[string][]string{},
+	}, m)
+
+	// no label list unless every label is known
+	m, err = parse("label1,label3", source)
+	assert.NoError(t, err)
+	assert.Nil(t, m)
+
+	m, err = parse("a,b", source, "--all")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a,b", source}, m.Args)
+
+	m, err = parse("--labels", "label*", source, "--parallel=2")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"label1", "label2"}, m.Labels)
+	assert.Equal(t, 2, m.Parallel)
+	assert.Equal(t, []string{source}, m.Args)
+
+	m, err = parse("--all", source)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"label1", "label2"}, m.Labels)
+
+	m, err = parse("backend", "--source=file://examples/fugu.groups.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"redis", "app", "worker"}, m.Labels)
+	assert.Equal(t, map[string][]string{"app": {"redis"}, "worker": {"redis"}}, m.DependsOn)
+	assert.Equal(t, []string{"--source=file://examples/fugu.groups.yml"}, m.Args)
+
+	m, err = parse("worker,redis", "--source=file://examples/fugu.groups.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"redis", "worker"}, m.Labels)
+
+	labels, dependents := reverseDependencies(m.Labels, m.DependsOn)
+	assert.Equal(t, []string{"worker", "redis"}, labels)
+	assert.Equal(t, map[string][]string{"redis": {"worker"}}, dependents)
+
+	_, err = parse("--all")
+	assert.Equal(t, ErrNoLabels, err)
+
+	_, err = parse("--all", source, "--parallel=0")
+	assert.Error(t, err)
+}
+
+func TestComplete(t *testing.T) {
+	source := "--source=file://examples/fugu.groups.yml"
+
+	assert.Equal(t, []string{"deploy", "destroy", "diff"}, Complete(collect.New(), []string{"d"}))
+	assert.Equal(t, []string{"destroy"}, Complete(collect.New(), []string{"help", "des"}))
+	assert.Equal(t, []string{"--detach"}, Complete(collect.New(), []string{"run", "--deta"}))
+	assert.Equal(t, []string{"--deploy-timeout"}, Complete(collect.New(), []string{"deploy", "--dep"}))
+	assert.Equal(t, []string{"zsh"}, Complete(collect.New(), []string{"completion", "z"}))
+	assert.Equal(t, []string{"app", "backend", "redis", "worker"}, Complete(collect.New(), []string{"run", source, ""}))
+	assert.Equal(t, []string{"worker"}, Complete(collect.New(), []string{"run", source, "--detach", "w"}))
+	assert.Empty(t, Complete(collect.New(), []string{"run", source, "app", ""}))
+	assert.Empty(t, Complete(collect.New(), []string{"bogus", source, ""}))
+
+	c := collect.New()
+	c.SetDefaultSource("file://examples/fugu.labels.yml")
+	assert.Equal(t, []string{"label1", "label2"}, Complete(c, []string{"destroy", "la"}))
+}
+
+func TestHelp(t *testing.T) {
+	// every command is documented
+	for _, cmd := range CommandList() {
+		assert.True(t, cmd.Synopsis != "" || cmd.Hidden, cmd.Name)
+	}
+
+	var buf bytes.Buffer
+	WriteCommandUsage(&buf, Lookup("destroy"), "file://fugu.yml")
+	assert.Contains(t, buf.String(), "Usage: fugu destroy [LABEL]\n\nKill a running container and remove it\n\nFugu options:\n")
+	assert.Contains(t, buf.String(), "  --source=file://fugu.yml (default)\n")
+
+	buf.Reset()
+	assert.NoError(t, WriteDocs(&buf, "roff", "1.0"))
+	assert.Contains(t, buf.String(), ".SS destroy\n\\fBfugu destroy\\fR [LABEL]\n")
+	assert.Contains(t, buf.String(), ".TP\n\\fB\\-\\-name\\fR=\"\"\n")
+
+	buf.Reset()
+	assert.NoError(t, WriteDocs(&buf, "markdown", "1.0"))
+	assert.Contains(t, buf.String(), "## destroy\n\n```\nfugu destroy [LABEL]\n```\n")
+	assert.Contains(t, buf.String(), "| `-t, --tag` |")
+
+	assert.Equal(t, ErrUnknownFormat, WriteDocs(&buf, "html", "1.0"))
+}
+
+func TestRegister(t *testing.T) {
+	defer func(c []*Command) { commands = c }(CommandList())
+
+	called := false
+	hello := &Command{Name: "hello", Synopsis: "Say hello", MaxArgs: 1,
+		Run: func(c *collect.Collector, p *data.Data, args []string) error {
+			called = true
+			assert.Equal(t, []string{"world"}, args)
+			return nil
+		}}
+	Register(hello)
+	assert.Equal(t, hello, Lookup("hello"))
+	assert.Equal(t, "hello", CommandList()[len(CommandList())-1].Name)
+	assert.Contains(t, CommandNames(), "hello")
+
+	assert.NoError(t, hello.Exec(collect.New(), []string{"world"}))
+	assert.True(t, called)
+	assert.Equal(t, ErrTooManyArgs, hello.Exec(collect.New(), []string{"world", "again"}))
+
+	// register replaces commands of the same name
+	n := len(CommandList())
+	Register(&Command{Name: "hello", Docker: containerCommand("start")})
+	assert.Len(t, CommandList(), n)
+	assert.Nil(t, Lookup("hello").Run)
+
+	assert.Panics(t, func() { Register(&Command{Name: "empty"}) })
+	assert.Nil(t, Lookup("bogus"))
+}
+
 func TestListImages(t *testing.T) {
 	(&CommandTest{
 		testDesc:       "plain images call",
@@ -809,3 +1319,93 @@ func TestListImages(t *testing.T) {
 		stdoutContains: []string{},
 	}).Test(t)
 }
+
+func TestDockerExecExitCode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fugu-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	script := "#!/bin/sh\nif [ \"$2\" = kill ]; then kill -9 $$; fi\nexit $2\n"
+	if err := ioutil.WriteFile(dir+"/docker", []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir)
+
+	assert.NoError(t, DockerExec(&Cmd{Command: "run", Args: []string{"0"}}, false))
+	assert.Equal(t, &ExitError{Code: 1}, DockerExec(&Cmd{Command: "run", Args: []string{"1"}}, false))
+	assert.Equal(t, &ExitError{Code: 125}, DockerExec(&Cmd{Command: "run", Args: []string{"125"}}, false))
+	assert.Equal(t, &ExitError{Code: 137}, DockerExec(&Cmd{Command: "run", Args: []string{"kill"}}, false))
+}
+
+func TestPluginEnv(t *testing.T) {
+	p := data.New().Set("image", "redis").Set("dry-run", "true").Set("env", "A=1", "B=2").Set("tasks.flush", "x")
+	assert.Equal(t, []string{"FUGU_DRY_RUN=true", "FUGU_ENV=A=1\nB=2", "FUGU_IMAGE=redis", "FUGU_TASKS_FLUSH=x",
+		"FUGU_DATA_VARS=FUGU_DRY_RUN FUGU_ENV FUGU_IMAGE FUGU_TASKS_FLUSH"}, dataEnv(p))
+	assert.Nil(t, LookupPlugin("bogus-plugin-that-does-not-exist"))
+}
+
+func TestTasks(t *testing.T) {
+	p := data.New().
+		Set("image", "foo").
+		Set("tasks.flush", "redis-cli flushall").
+		Set("tasks.migrate.args", "db:migrate").
+		Set("tasks.migrate.command", "rake").
+		Set("tasks.test.command", "rake", "test").
+		Set("tasks.test.rm", "true")
+
+	tasks, err := Tasks(p)
+	assert.NoError(t, err)
+	assert.Equal(t, []*Task{
+		{Name: "flush", Command: []string{"redis-cli", "flushall"}},
+		{Name: "migrate", Command: []string{"rake", "db:migrate"}},
+		{Name: "test", Command: []string{"rake", "test"}, Rm: true},
+	}, tasks)
+
+	_, err = Tasks(data.New().Set("tasks.migrate.bogus", "x"))
+	assert.EqualError(t, err, "task migrate: unknown key bogus")
+}
+
+func TestCommandTask(t *testing.T) {
+	(&CommandTest{
+		testDesc:       "task: list",
+		command:        "task",
+		argsIn:         []string{"app", "--source=file://examples/fugu.tasks.yml", "--list"},
+		errOut:         nil,
+		stdoutContains: []string{"TASK     VIA       COMMAND\nflush    exec      redis-cli flushall\nmigrate  exec      env RAILS_ENV=production rake db:migrate\ntest     run --rm  rake test --verbose\n"},
+	}).Test(t)
+
+	(&CommandTest{
+		testDesc:       "task: exec",
+		command:        "task",
+		argsIn:         []string{"app", "--source=file://examples/fugu.tasks.yml", "--dry-run", "migrate", "--step=1"},
+		errOut:         nil,
+		stdoutContains: []string{"docker exec my-app env RAILS_ENV=production rake db:migrate --step=1\n"},
+	}).Test(t)
+
+	(&CommandTest{
+		testDesc:       "task: run --rm",
+		command:        "task",
+		argsIn:         []string{"app", "--source=file://examples/fugu.tasks.yml", "--dry-run", "--tty", "test"},
+		errOut:         nil,
+		stdoutContains: []string{"docker run --rm --tty rails rake test --verbose\n"},
+	}).Test(t)
+
+	(&CommandTest{
+		testDesc:       "task: missing",
+		command:        "task",
+		argsIn:         []string{"app", "--source=file://examples/fugu.tasks.yml"},
+		errOut:         ErrMissingTask,
+		stdoutContains: []string{},
+	}).Test(t)
+
+	(&CommandTest{
+		testDesc:       "task: unknown",
+		command:        "task",
+		argsIn:         []string{"app", "--source=file://examples/fugu.tasks.yml", "bogus"},
+		errOut:         fmt.Errorf("unknown task bogus"),
+		stdoutContains: []string{},
+	}).Test(t)
+}
@@ -4,13 +4,29 @@ import (
 	"github.com/mattes/go-collect/flags"
 )
 
-var FuguFlags = make(map[string]*flags.Flags)
+// FuguFlags are package vars, so commands can refer to them in init
+var FuguFlags = fuguFlags()
 
-func init() {
+func fuguFlags() map[string]*flags.Flags {
+	FuguFlags := make(map[string]*flags.Flags)
 
 	FuguCommon := flags.New("")
 	FuguCommon.Var([]string{"-source"}, "Get data from this source")
 	FuguCommon.Bool([]string{"-dry-run"}, false, "Just print commands")
+	FuguCommon.String([]string{"-backend"}, "cli", "Run docker commands with the docker cli or the engine api")
+
+	// FuguMulti selects several labels, see MultiLabel. Interactive
+	// commands like shell run for one label only.
+	FuguMulti := flags.New("")
+	FuguMulti.Bool([]string{"-all"}, false, "Run for all labels")
+	FuguMulti.String([]string{"-labels"}, "", "Run for all labels matching this pattern, i.e. 'api-*'")
+	FuguMulti.Int64([]string{"-parallel"}, DefaultParallel, "Run this many labels at the same time")
+
+	FuguWait := flags.New("")
+	FuguWait.String([]string{"-wait-for-port"}, "", "Wait until this container port accepts connections")
+	FuguWait.String([]string{"-wait-for-http"}, "", "Wait until this http path answers without error")
+	FuguWait.String([]string{"-wait-for-log"}, "", "Wait until the logs match this regular expression")
+	FuguWait.Bool([]string{"-wait-for-healthy"}, false, "Wait until docker reports the container healthy")
 
 	// Define FuguFlags["build"]
 	FuguFlags["build"] = flags.New("fugu")
@@ -18,7 +34,7 @@ func init() {
 	FuguFlags["build"].String([]string{"-path"}, "", "PATH")
 	FuguFlags["build"].String([]string{"-url"}, "", "URL")
 	FuguFlags["build"].Bool([]string{"-tag-git-branch"}, false, "Tag with current git branch")
-	FuguFlags["build"] = flags.Merge(FuguCommon, FuguFlags["build"])
+	FuguFlags["build"] = flags.Merge(FuguCommon, FuguMulti, FuguFlags["build"])
 	FuguFlags["build"].Name = "fugu"
 
 	// Define FuguFlags["run"]
@@ -26,7 +42,10 @@ func init() {
 	FuguFlags["run"].String([]string{"-image"}, "", "Name of the image")
 	FuguFlags["run"].String([]string{"-command"}, "", "COMMAND")
 	FuguFlags["run"].Var([]string{"-arg"}, "ARG")
-	FuguFlags["run"] = flags.Merge(FuguCommon, FuguFlags["run"])
+	FuguFlags["run"].Bool([]string{"-replace"}, false, "Stop and remove an existing container with the same name first")
+	FuguFlags["run"].Int64([]string{"-replace-timeout"}, DefaultReplaceTimeout, "Seconds to wait for the old container to stop before killing it")
+	FuguFlags["run"].Int64([]string{"-wait-timeout"}, DefaultWaitTimeout, "Seconds to wait for the wait-for conditions")
+	FuguFlags["run"] = flags.Merge(FuguCommon, FuguMulti, FuguFlags["run"], FuguWait)
 	FuguFlags["run"].Name = "fugu"
 
 	// Define FuguFlags["exec"]
@@ -47,21 +66,63 @@ func init() {
 	// Define FuguFlags["destroy"]
 	FuguFlags["destroy"] = flags.New("fugu")
 	FuguFlags["destroy"].String([]string{"-name"}, "", "Name of the container to be destroyed")
-	FuguFlags["destroy"] = flags.Merge(FuguCommon, FuguFlags["destroy"])
+	FuguFlags["destroy"] = flags.Merge(FuguCommon, FuguMulti, FuguFlags["destroy"])
 	FuguFlags["destroy"].Name = "fugu"
 
+	// Define FuguFlags["logs"]
+	FuguFlags["logs"] = flags.New("fugu")
+	FuguFlags["logs"].String([]string{"-name"}, "", "Name of the container")
+	FuguFlags["logs"] = flags.Merge(FuguCommon, FuguMulti, FuguFlags["logs"])
+	FuguFlags["logs"].Name = "fugu"
+
+	// Define FuguFlags["start"]
+	FuguFlags["start"] = flags.New("fugu")
+	FuguFlags["start"].String([]string{"-name"}, "", "Name of the container to be started")
+	FuguFlags["start"] = flags.Merge(FuguCommon, FuguMulti, FuguFlags["start"])
+	FuguFlags["start"].Name = "fugu"
+
+	// Define FuguFlags["stop"]
+	FuguFlags["stop"] = flags.New("fugu")
+	FuguFlags["stop"].String([]string{"-name"}, "", "Name of the container to be stopped")
+	FuguFlags["stop"] = flags.Merge(FuguCommon, FuguMulti, FuguFlags["stop"])
+	FuguFlags["stop"].Name = "fugu"
+
+	// Define FuguFlags["restart"]
+	FuguFlags["restart"] = flags.New("fugu")
+	FuguFlags["restart"].String([]string{"-name"}, "", "Name of the container to be restarted")
+	FuguFlags["restart"] = flags.Merge(FuguCommon, FuguMulti, FuguFlags["restart"])
+	FuguFlags["restart"].Name = "fugu"
+
+	// Define FuguFlags["kill"]
+	FuguFlags["kill"] = flags.New("fugu")
+	FuguFlags["kill"].String([]string{"-name"}, "", "Name of the container to be killed")
+	FuguFlags["kill"] = flags.Merge(FuguCommon, FuguMulti, FuguFlags["kill"])
+	FuguFlags["kill"].Name = "fugu"
+
+	// Define FuguFlags["pause"]
+	FuguFlags["pause"] = flags.New("fugu")
+	FuguFlags["pause"].String([]string{"-name"}, "", "Name of the container to be paused")
+	FuguFlags["pause"] = flags.Merge(FuguCommon, FuguMulti, FuguFlags["pause"])
+	FuguFlags["pause"].Name = "fugu"
+
+	// Define FuguFlags["unpause"]
+	FuguFlags["unpause"] = flags.New("fugu")
+	FuguFlags["unpause"].String([]string{"-name"}, "", "Name of the container to be unpaused")
+	FuguFlags["unpause"] = flags.Merge(FuguCommon, FuguMulti, FuguFlags["unpause"])
+	FuguFlags["unpause"].Name = "fugu"
+
 	// Define FuguFlags["push"]
 	FuguFlags["push"] = flags.New("fugu")
 	FuguFlags["push"].String([]string{"-image"}, "", "Name of the image")
 	FuguFlags["push"].String([]string{"-tag"}, "", "Push this tag of the image")
-	FuguFlags["push"] = flags.Merge(FuguCommon, FuguFlags["push"])
+	FuguFlags["push"] = flags.Merge(FuguCommon, FuguMulti, FuguFlags["push"])
 	FuguFlags["push"].Name = "fugu"
 
 	// Define FuguFlags["pull"]
 	FuguFlags["pull"] = flags.New("fugu")
 	FuguFlags["pull"].String([]string{"-image"}, "", "Name of the image")
 	FuguFlags["pull"].String([]string{"-tag"}, "", "Pull this tag of the image")
-	FuguFlags["pull"] = flags.Merge(FuguCommon, FuguFlags["pull"])
+	FuguFlags["pull"] = flags.Merge(FuguCommon, FuguMulti, FuguFlags["pull"])
 	FuguFlags["pull"].Name = "fugu"
 
 	// Define FuguFlags["images"]
@@ -72,11 +133,65 @@ func init() {
 	FuguFlags["images"].String([]string{"-file"}, "~/.dockercfg", "Read credentials from this file")
 	FuguFlags["images"].Bool([]string{"-password-stdin"}, false, "Ask for password")
 
+	// Define FuguFlags["up"]
+	FuguFlags["up"] = flags.New("fugu")
+	FuguFlags["up"].String([]string{"-command"}, "", "COMMAND")
+	FuguFlags["up"].Var([]string{"-arg"}, "ARG")
+	FuguFlags["up"] = flags.Merge(FuguFlags["build"], FuguFlags["up"])
+	FuguFlags["up"].Name = "fugu"
+
+	// Define FuguFlags["deploy"]
+	FuguFlags["deploy"] = flags.New("fugu")
+	FuguFlags["deploy"].String([]string{"-image"}, "", "Name of the image")
+	FuguFlags["deploy"].String([]string{"-command"}, "", "COMMAND")
+	FuguFlags["deploy"].Var([]string{"-arg"}, "ARG")
+	FuguFlags["deploy"].Int64([]string{"-deploy-timeout"}, DefaultDeployTimeout, "Seconds to wait for the new container to get ready")
+	FuguFlags["deploy"].Bool([]string{"-stop-first"}, false, "Stop the old container before starting the new one, allows fixed host ports")
+	FuguFlags["deploy"] = flags.Merge(FuguCommon, FuguMulti, FuguFlags["deploy"], FuguWait)
+	FuguFlags["deploy"].Name = "fugu"
+
+	// Define FuguFlags["status"]
+	FuguFlags["status"] = flags.New("fugu")
+	FuguFlags["status"].Var([]string{"-source"}, "Get data from this source")
+	FuguFlags["status"].String([]string{"-backend"}, "cli", "Inspect with the docker cli or the engine api")
+	FuguFlags["status"].String([]string{"-name"}, "", "Name of the container")
+	FuguFlags["status"].Bool([]string{"-json"}, false, "Print status as json")
+
+	// Define FuguFlags["diff"]
+	FuguFlags["diff"] = flags.New("fugu")
+	FuguFlags["diff"].Var([]string{"-source"}, "Get data from this source")
+	FuguFlags["diff"].String([]string{"-backend"}, "cli", "Inspect with the docker cli or the engine api")
+	FuguFlags["diff"].String([]string{"-image"}, "", "Name of the image")
+	FuguFlags["diff"].String([]string{"-command"}, "", "COMMAND")
+	FuguFlags["diff"].Var([]string{"-arg"}, "ARG")
+
 	// Define FuguFlags["show-data"]
 	FuguFlags["show-data"] = flags.New("fugu")
 	FuguFlags["show-data"].Var([]string{"-source"}, "Get data from this source")
+	FuguFlags["show-data"].Bool([]string{"-origin"}, false, "Show the source of every value")
+
+	// Define FuguFlags["man"]
+	FuguFlags["man"] = flags.New("fugu")
+	FuguFlags["man"].String([]string{"-format"}, "roff", "Print roff, markdown or text")
 
 	// Define FuguFlags["show-labels"]
 	FuguFlags["show-labels"] = flags.New("fugu")
 	FuguFlags["show-labels"].Var([]string{"-source"}, "Get data from this source")
+
+	// Define FuguFlags["task"]
+	FuguFlags["task"] = flags.New("fugu")
+	FuguFlags["task"].String([]string{"-name"}, "", "Name of the container")
+	FuguFlags["task"].String([]string{"-image"}, "", "Name of the image, for tasks with rm")
+	FuguFlags["task"].Bool([]string{"-list"}, false, "List the tasks of the label")
+	FuguFlags["task"] = flags.Merge(FuguCommon, FuguFlags["task"])
+	FuguFlags["task"].Name = "fugu"
+
+	// Define FuguFlags["plugin"], plugins parse all other flags
+	FuguFlags["plugin"] = flags.New("fugu")
+	FuguFlags["plugin"].Var([]string{"-source"}, "Get data from this source")
+	FuguFlags["plugin"].Bool([]string{"-all"}, false, "Run for all labels")
+	FuguFlags["plugin"].String([]string{"-labels"}, "", "Run for all labels matching this pattern, i.e. 'api-*'")
+	FuguFlags["plugin"].Int64([]string{"-parallel"}, DefaultParallel, "Run this many labels at the same time")
+
+	return FuguFlags
 }
@@ -0,0 +1,180 @@
+package fugu
+
+import (
+	"fmt"
+	"github.com/mattes/go-collect"
+	"github.com/mattes/go-collect/flags"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// usageIntro is printed by fugu help before the commands
+const usageIntro = "Swiss Army knife for Docker."
+
+// usageOutro is printed by fugu help after the commands
+const usageOutro = `
+LABEL can be a list like label1,label2 or a group. Select labels with
+--all or --labels 'api-*', too. Several labels run in parallel, labels
+with depends-on after their dependencies.`
+
+// visibleCommands returns the commands fugu help lists
+func visibleCommands() []*Command {
+	out := make([]*Command, 0, len(commands))
+	for _, cmd := range commands {
+		if !cmd.Hidden {
+			out = append(out, cmd)
+		}
+	}
+	return out
+}
+
+// WriteUsage writes the usage of fugu, listing all commands and plugins
+func WriteUsage(w io.Writer, plugins ...string) {
+	width := 0
+	for _, name := range append(CommandNames(), plugins...) {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+
+	fmt.Fprintf(w, "Usage: fugu COMMAND [LABEL] [arg...]\n\n%v\n\nCommands:\n", usageIntro)
+	for _, h := range visibleCommands() {
+		fmt.Fprintf(w, "    %-*v  %v\n", width, h.Name, h.Synopsis)
+	}
+	if len(plugins) > 0 {
+		fmt.Fprintln(w, "\nPlugins:")
+		for _, name := range plugins {
+			fmt.Fprintf(w, "    %-*v  %v\n", width, name, "Run "+PluginPrefix+name)
+		}
+	}
+	fmt.Fprintf(w, "%v\n\nRun 'fugu help COMMAND' for more information on a command.\n", usageOutro)
+}
+
+// WriteCommandUsage writes the usage of a command like fugu help COMMAND
+func WriteCommandUsage(w io.Writer, h *Command, defaultSource string) {
+	fmt.Fprintf(w, "Usage: %v\n\n%v\n", h.Usage(), h.Text())
+
+	hasSource := false
+	for _, f := range h.Flags() {
+		fmt.Fprintln(w)
+		if f.Name != "" {
+			fmt.Fprintln(w, upperFirst(f.Name)+" options:")
+		}
+		f.WriteUsage(w)
+		hasSource = hasSource || f.Exists("source")
+	}
+
+	ex := collect.SourceExampleUrls()
+	sort.Strings(ex)
+	if hasSource && len(ex) > 0 {
+		fmt.Fprintln(w, "\nExample source options:")
+		if defaultSource != "" {
+			fmt.Fprintln(w, "  "+flags.Nice("source", defaultSource)+" (default)")
+		}
+		for _, v := range ex {
+			fmt.Fprintln(w, "  "+v)
+		}
+	}
+}
+
+// WriteText writes the usage of fugu and all commands, see fugu/usage.txt
+func WriteText(w io.Writer) {
+	WriteUsage(w)
+	for _, h := range visibleCommands() {
+		fmt.Fprint(w, "\n\n------------------------------------------\n\n\n")
+		WriteCommandUsage(w, h, "")
+	}
+}
+
+// WriteDocs writes the docs of all commands as roff, markdown or text
+func WriteDocs(w io.Writer, format, version string) error {
+	switch format {
+	case "", "roff":
+		WriteMan(w, version)
+	case "markdown":
+		WriteMarkdown(w)
+	case "text":
+		WriteText(w)
+	default:
+		return ErrUnknownFormat
+	}
+	return nil
+}
+
+// WriteMan writes the man page of fugu in roff
+func WriteMan(w io.Writer, version string) {
+	fmt.Fprintf(w, ".TH FUGU 1 \"\" \"fugu %v\" \"fugu manual\"\n", roff(version))
+	fmt.Fprintf(w, ".SH NAME\nfugu \\- %v\n", roff(usageIntro))
+	fmt.Fprintf(w, ".SH SYNOPSIS\n\\fBfugu\\fR COMMAND [LABEL] [arg...]\n")
+	fmt.Fprintf(w, ".SH DESCRIPTION\n%v\n", roffText(usageIntro+"\n"+usageOutro))
+
+	fmt.Fprintln(w, ".SH COMMANDS")
+	for _, h := range visibleCommands() {
+		fmt.Fprintf(w, ".SS %v\n\\fBfugu %v\\fR %v\n.PP\n%v\n", roff(h.Name), roff(h.Name), roff(h.Args), roffText(h.Text()))
+		for _, fs := range h.Flags() {
+			for _, f := range fs.All() {
+				fmt.Fprintf(w, ".TP\n\\fB%v\\fR=%v\n%v\n", roff(flagNames(f)), roff(fmt.Sprintf("%q", f.DefValue)), roffText(f.Usage))
+			}
+		}
+	}
+}
+
+// WriteMarkdown writes the docs of all commands in markdown
+func WriteMarkdown(w io.Writer) {
+	fmt.Fprintf(w, "# fugu\n\n%v\n\n%v\n\n", usageIntro, strings.TrimSpace(usageOutro))
+	for _, h := range visibleCommands() {
+		fmt.Fprintf(w, "* [%v](#%v) %v\n", h.Name, h.Name, h.Synopsis)
+	}
+
+	for _, h := range visibleCommands() {
+		fmt.Fprintf(w, "\n## %v\n\n```\n%v\n```\n\n%v\n", h.Name, h.Usage(), h.Text())
+		for _, fs := range h.Flags() {
+			fmt.Fprintf(w, "\n| %v option | Default | Description |\n| --- | --- | --- |\n", upperFirst(fs.Name))
+			for _, f := range fs.All() {
+				fmt.Fprintf(w, "| `%v` | `%q` | %v |\n", flagNames(f), f.DefValue, strings.Replace(f.Usage, "|", "\\|", -1))
+			}
+		}
+	}
+}
+
+// flagNames formats mflag names, i.e. -e, --env
+func flagNames(f flags.Flag) string {
+	names := make([]string, 0, len(f.Names))
+	for _, n := range f.Names {
+		names = append(names, "-"+n)
+	}
+	return strings.Join(names, ", ")
+}
+
+// roff escapes s for roff
+func roff(s string) string {
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	return strings.Replace(s, "-", "\\-", -1)
+}
+
+// roffText escapes text for roff, keeping its lines
+func roffText(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	for i, l := range lines {
+		l = roff(l)
+		if l == "" {
+			l = ".PP"
+		} else if strings.HasPrefix(l, ".") || strings.HasPrefix(l, "'") {
+			l = "\\&" + l
+		}
+		lines[i] = l
+	}
+	return strings.Join(lines, "\n")
+}
+
+// upperFirst makes the first letter uppercase
+func upperFirst(s string) string {
+	if s == "" {
+		return ""
+	}
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[n:]
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/github/hub/github"
+	"github.com/mattes/go-collect"
 	"github.com/mattes/go-collect/data"
 	"github.com/mattes/go-collect/flags"
 	"gopkg.in/mattes/go-expand-tilde.v1"
@@ -13,23 +14,142 @@ import (
 	"os"
 	"os/exec"
 	"sort"
-	"strings"
 	"sync"
+	"syscall"
 )
 
+// ExitError is returned when docker exits with a non-zero status
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("docker exited with status %v", e.Code)
+}
+
 // DockerExec runs a docker command
-func DockerExec(cmd string, printCmd bool) {
+// It returns an *ExitError if docker exits with a non-zero status.
+func DockerExec(cmd *Cmd, printCmd bool) error {
 	if printCmd {
-		fmt.Println(cmd)
+		fmt.Println(cmd.String())
 	}
-	c := exec.Command("sh", "-c", cmd)
+	argv := cmd.Argv()
+	c := exec.Command(argv[0], argv[1:]...)
 	c.Stdout = os.Stdout
 	c.Stderr = os.Stderr
 	c.Stdin = os.Stdin
-	if err := c.Run(); err != nil {
-		os.Exit(2)
+	if err := runForeground(c); err != nil {
+		if code, ok := exitStatus(err); ok {
+			return &ExitError{Code: code}
+		}
+		return err
+	}
+	return nil
+}
+
+// exitStatus returns the exit status of an exited command.
+// Like a shell, it returns 128 + signal if the command was killed.
+func exitStatus(err error) (int, bool) {
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return 0, false
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok {
+		return 1, true
+	}
+	if status.Signaled() {
+		return 128 + int(status.Signal()), true
+	}
+	return status.ExitStatus(), true
+}
+
+// Exec runs a docker command with the backend selected by the
+// backend option: cli (default) runs the docker binary, api talks
+// to the Docker Engine API directly.
+func Exec(p *data.Data, cmd *Cmd, printCmd bool) error {
+	switch p.Get("backend") {
+	case "", "cli":
+		return DockerExec(cmd, printCmd)
+
+	case "api":
+		if printCmd {
+			fmt.Println(cmd.String())
+		}
+		e, err := NewEngine("")
+		if err != nil {
+			return err
+		}
+		return e.Exec(cmd)
+	}
+	return ErrUnknownBackend
+}
+
+// ExecCommand runs a command returned by a DockerFunc.
+// With dry-run it only prints what would be run. A detached run
+// returns once the wait-for conditions hold.
+func ExecCommand(p *data.Data, cmd *Cmd) error {
+	if cmd.Command == "run" && !p.IsTrue("dry-run") {
+		if err := checkWaitRun(p, cmd); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if cmd.Command == "run" && p.IsTrue("replace") {
+		err = replaceContainer(p, cmd)
+	} else {
+		err = execOrPrint(p, cmd)
+	}
+	if err != nil {
+		return err
+	}
+
+	// detached containers may have to get ready first
+	if cmd.Command == "run" && cmd.Flags.IsTrue("detach") && !p.IsTrue("dry-run") {
+		return waitRun(p, cmd)
+	}
+	return nil
+}
+
+// execOrPrint runs cmd or only prints it with dry-run
+func execOrPrint(p *data.Data, cmd *Cmd) error {
+	if p.IsTrue("dry-run") {
+		fmt.Println(cmd.String())
+		return nil
+	}
+	return Exec(p, cmd, true)
+}
+
+// containerCommand returns a DockerFunc for docker commands
+// that take the container name as their only argument, i.e. docker stop
+func containerCommand(command string) DockerFunc {
+	return func(c *collect.Collector, p *data.Data, args []string) (cmd *Cmd, err error) {
+		if p.Get("name") == "" {
+			return nil, ErrMissingName
+		}
+
+		if len(args) > 0 {
+			return nil, ErrTooManyArgs
+		}
+
+		pf, err := filterDockerFlags(p, command)
+		if err != nil {
+			return nil, err
+		}
+
+		return buildDockerCmd(command, pf, p.Get("name")), nil
+	}
+}
+
+// labelData parses the data of label from the sources of c
+func labelData(c *collect.Collector, label string, f ...*flags.Flags) (*data.Data, error) {
+	args := []string{label}
+	for _, s := range c.Sources() {
+		args = append(args, "--source="+s)
 	}
-	os.Exit(0)
+	p, _, err := collect.New().Parse(args, f...)
+	return p, err
 }
 
 func filterDockerFlags(p *data.Data, command string) (*data.Data, error) {
@@ -41,27 +161,22 @@ func filterDockerFlags(p *data.Data, command string) (*data.Data, error) {
 	return data.Filter(p, df), nil
 }
 
-// buildDockerStr builds the docker command with all options and args
-func buildDockerStr(command string, p *data.Data, args ...string) string {
-	str := []string{}
-	for _, n := range p.Keys() {
-		for _, o := range p.GetAll(n) {
-
-			if n == "volume" {
-				o = expandTilde(o)
-			}
-
-			nice := strings.TrimSpace(flags.Nice(n, o))
-			if nice != "" {
-				str = append(str, nice)
-			}
+// buildDockerCmd builds the docker command with all options and args
+func buildDockerCmd(command string, p *data.Data, args ...string) *Cmd {
+	if p.Exists("volume") {
+		volumes := p.GetAll("volume")
+		expanded := make([]string, 0, len(volumes))
+		for _, v := range volumes {
+			expanded = append(expanded, expandTilde(v))
 		}
+		p.Set("volume", expanded...)
 	}
-	sort.Sort(sort.StringSlice(str))
 
-	str = append([]string{"docker", command}, str...)
-	str = append(str, args...)
-	return strings.Join(str, " ")
+	return &Cmd{
+		Command: command,
+		Flags:   p,
+		Args:    args,
+	}
 }
 
 func expandTilde(path string) string {
@@ -0,0 +1,42 @@
+package fugu
+
+import (
+	"fmt"
+	"github.com/mattes/go-collect"
+	"github.com/mattes/go-collect/data"
+	"os"
+	"os/exec"
+)
+
+// Hook stages, the hook keys of a label are i.e. pre-build or post-run
+const (
+	PreHook  = "pre"
+	PostHook = "post"
+)
+
+// runHooks runs the stage hooks of command on the host, each with sh -c and
+// the data of the label in env vars like FUGU_IMAGE, see dataEnv. It stops
+// at the first failing hook. With dry-run it only prints the hooks.
+func runHooks(c *collect.Collector, p *data.Data, stage, command string) error {
+	key := stage + "-" + command
+	for _, hook := range p.GetAll(key) {
+		if hook == "" {
+			continue
+		}
+
+		if p.IsTrue("dry-run") {
+			fmt.Println("sh -c " + shellQuote(hook))
+			continue
+		}
+
+		cmd := exec.Command("sh", "-c", hook)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		cmd.Env = append(os.Environ(), dataEnv(p)...)
+		cmd.Env = append(cmd.Env, LabelEnv+"="+c.Label())
+
+		if err := runForeground(cmd); err != nil {
+			return fmt.Errorf("%v hook failed: %v", key, err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,377 @@
+package fugu
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mattes/go-collect"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// DefaultParallel is used if parallel is not set
+const DefaultParallel = 4
+
+// executable is the running binary, every label runs in a copy of it.
+// It is resolved at start, a relative os.Args[0] may point elsewhere
+// later. Programs embedding fugu must call Main(os.Args[1:]).
+var executable = resolveExecutable()
+
+func resolveExecutable() string {
+	bin, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		return os.Args[0]
+	}
+	if abs, err := filepath.Abs(bin); err == nil {
+		return abs
+	}
+	return bin
+}
+
+// MultiLabel runs one command for several labels
+type MultiLabel struct {
+	Labels []string
+
+	// Parallel is the number of labels run at the same time
+	Parallel int
+
+	// Args are the args of the command without the label selection
+	Args []string
+
+	// DependsOn are the dependencies between Labels. Labels are
+	// sorted so that dependencies come first.
+	DependsOn map[string][]string
+}
+
+// stopCommands run for labels before their dependencies
+var stopCommands = []string{"destroy", "stop", "kill", "pause"}
+
+// LabelResult is the outcome of the command for one label
+type LabelResult struct {
+	Label string
+	Err   error
+
+	// Skipped is true if a dependency failed, see Err
+	Skipped bool
+}
+
+// ParseMultiLabel finds a label list like label1,label2, a group, --all or
+// --labels 'api-*' in args. It returns nil if at most one label is given.
+// A group selects the dependencies of its labels, too. The labels are
+// those of c, which must have parsed args already.
+func ParseMultiLabel(c *collect.Collector, args []string) (*MultiLabel, error) {
+	m := &MultiLabel{Parallel: DefaultParallel, Args: make([]string, 0, len(args))}
+	all, pattern, group, list := false, "", "", []string(nil)
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name, value, hasValue := splitFlag(arg)
+
+		switch name {
+		case "all":
+			all = !hasValue || value == "true"
+			continue
+
+		case "labels", "parallel":
+			if !hasValue {
+				if i+1 >= len(args) {
+					return nil, fmt.Errorf("%v: %v", name, ErrMissingFlag.Error())
+				}
+				i++
+				value = args[i]
+			}
+			if name == "labels" {
+				pattern = value
+			} else {
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 1 {
+					return nil, fmt.Errorf("parallel: %v is not a positive number", value)
+				}
+				m.Parallel = n
+			}
+			continue
+		}
+
+		// like collect.ParseLabel, the label is the first arg
+		if i == 0 && !strings.HasPrefix(arg, "-") {
+			if strings.Contains(arg, ",") {
+				list = strings.Split(arg, ",")
+				continue
+			}
+			group = arg
+		}
+		m.Args = append(m.Args, arg)
+	}
+
+	if !all && pattern == "" && group == "" && list == nil {
+		return nil, nil
+	}
+
+	known := c.Labels()
+
+	// the first arg is only a group or a label list if the sources know it
+	groupLabels, isGroup := c.Groups()[group]
+	if list != nil && !knownLabels(known, list) {
+		m.Args = append([]string{strings.Join(list, ",")}, m.Args...)
+		list = nil
+	}
+	if isGroup {
+		m.Args = m.Args[1:]
+	} else if !all && pattern == "" && list == nil {
+		return nil, nil
+	}
+
+	switch {
+	case all:
+		m.Labels = known
+
+	case isGroup:
+		m.Labels = withDependencies(groupLabels, c.Dependencies())
+
+	case pattern != "":
+		for _, l := range known {
+			if ok, err := path.Match(pattern, l); err != nil {
+				return nil, fmt.Errorf("labels: %v", err.Error())
+			} else if ok {
+				m.Labels = append(m.Labels, l)
+			}
+		}
+
+	default:
+		for _, l := range list {
+			if l != "" {
+				m.Labels = append(m.Labels, l)
+			}
+		}
+	}
+
+	if len(m.Labels) == 0 {
+		return nil, ErrNoLabels
+	}
+
+	m.Labels, m.DependsOn = sortByDependencies(m.Labels, c.Dependencies())
+	return m, nil
+}
+
+// knownLabels returns true if every non-empty label of list is known
+func knownLabels(known, list []string) bool {
+	for _, l := range list {
+		if l != "" && !containsString(known, l) {
+			return false
+		}
+	}
+	return true
+}
+
+// withDependencies adds the dependencies of labels recursively
+func withDependencies(labels []string, deps map[string][]string) []string {
+	out := make([]string, 0, len(labels))
+	for _, l := range labels {
+		if !containsString(out, l) {
+			out = append(out, l)
+		}
+	}
+	for i := 0; i < len(out); i++ {
+		for _, d := range deps[out[i]] {
+			if !containsString(out, d) {
+				out = append(out, d)
+			}
+		}
+	}
+	return out
+}
+
+// sortByDependencies sorts labels so that dependencies come first, otherwise
+// the order is kept. It returns the dependencies between labels only.
+// Sources report cycles, so there are none.
+func sortByDependencies(labels []string, deps map[string][]string) ([]string, map[string][]string) {
+	selected := make(map[string][]string)
+	for _, l := range labels {
+		for _, d := range deps[l] {
+			if containsString(labels, d) && !containsString(selected[l], d) {
+				selected[l] = append(selected[l], d)
+			}
+		}
+	}
+
+	sorted := make([]string, 0, len(labels))
+	var visit func(label string)
+	visit = func(label string) {
+		if containsString(sorted, label) {
+			return
+		}
+		for _, d := range selected[label] {
+			visit(d)
+		}
+		sorted = append(sorted, label)
+	}
+	for _, l := range labels {
+		visit(l)
+	}
+	return sorted, selected
+}
+
+// splitFlag splits --name=value. Args that are no flags return an empty name.
+func splitFlag(arg string) (name, value string, hasValue bool) {
+	if !strings.HasPrefix(arg, "-") || arg == "-" || arg == "--" {
+		return "", "", false
+	}
+	name = strings.TrimLeft(arg, "-")
+	if i := strings.Index(name, "="); i >= 0 {
+		return name[:i], name[i+1:], true
+	}
+	return name, "", false
+}
+
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Run runs fugu command label args for every label, at most Parallel at
+// the same time and dependencies first, or last for stopCommands. Each label
+// runs as its own fugu process, its output is prefixed with the label. Run
+// prints a summary and returns ErrLabelsFailed if the command failed for any
+// label.
+func (m *MultiLabel) Run(command string, stdout, stderr io.Writer) error {
+	labels, waitFor := m.Labels, m.DependsOn
+	if containsString(stopCommands, command) {
+		labels, waitFor = reverseDependencies(m.Labels, m.DependsOn)
+	}
+
+	width := 0
+	index := make(map[string]int)
+	done := make(map[string]chan struct{})
+	for i, l := range labels {
+		if len(l) > width {
+			width = len(l)
+		}
+		index[l] = i
+		done[l] = make(chan struct{})
+	}
+
+	var mu sync.Mutex
+	results := make([]LabelResult, len(labels))
+	sem := make(chan struct{}, m.Parallel)
+	var wg sync.WaitGroup
+
+	// labels are sorted, so labels only wait for labels started before
+	for i, label := range labels {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, label string) {
+			defer func() { close(done[label]); <-sem; wg.Done() }()
+
+			for _, w := range waitFor[label] {
+				<-done[w]
+				if results[index[w]].Err != nil {
+					results[i] = LabelResult{Label: label, Err: fmt.Errorf("%v failed", w), Skipped: true}
+					return
+				}
+			}
+
+			prefix := fmt.Sprintf("%-*v | ", width, label)
+			out := &prefixWriter{w: stdout, mu: &mu, prefix: prefix}
+			errOut := &prefixWriter{w: stderr, mu: &mu, prefix: prefix}
+
+			c := exec.Command(executable, append([]string{command, label}, m.Args...)...)
+			c.Stdout, c.Stderr = out, errOut
+			err := c.Run()
+			out.Flush()
+			errOut.Flush()
+
+			if code, ok := exitStatus(err); ok {
+				err = &ExitError{Code: code}
+			}
+			results[i] = LabelResult{Label: label, Err: err}
+		}(i, label)
+	}
+	wg.Wait()
+
+	fmt.Fprintln(stdout)
+	if err := writeLabelResults(stdout, results); err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		if r.Err != nil {
+			return ErrLabelsFailed
+		}
+	}
+	return nil
+}
+
+// reverseDependencies sorts labels so that labels depending on
+// others come first, every label then waits for its dependents
+func reverseDependencies(labels []string, deps map[string][]string) ([]string, map[string][]string) {
+	dependents := make(map[string][]string)
+	for _, l := range labels {
+		for _, d := range deps[l] {
+			dependents[d] = append(dependents[d], l)
+		}
+	}
+	return sortByDependencies(labels, dependents)
+}
+
+// writeLabelResults prints the summary table of a multi label run
+func writeLabelResults(out io.Writer, results []LabelResult) error {
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "LABEL\tRESULT")
+	for _, r := range results {
+		result := "ok"
+		if r.Skipped {
+			result = "skipped, " + r.Err.Error()
+		} else if e, ok := r.Err.(*ExitError); ok {
+			result = fmt.Sprintf("failed, exit status %v", e.Code)
+		} else if r.Err != nil {
+			result = "failed, " + r.Err.Error()
+		}
+		fmt.Fprintf(w, "%v\t%v\n", r.Label, result)
+	}
+	return w.Flush()
+}
+
+// prefixWriter writes whole lines prefixed to w, so concurrent
+// writers sharing mu don't mix their lines
+type prefixWriter struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	prefix string
+	buf    bytes.Buffer
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf.Write(b)
+	for {
+		i := bytes.IndexByte(p.buf.Bytes(), '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		p.writeLine(p.buf.Next(i + 1))
+	}
+}
+
+// Flush writes an incomplete last line
+func (p *prefixWriter) Flush() {
+	if p.buf.Len() > 0 {
+		p.writeLine(append(p.buf.Next(p.buf.Len()), '\n'))
+	}
+}
+
+func (p *prefixWriter) writeLine(line []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	io.WriteString(p.w, p.prefix)
+	p.w.Write(line)
+}
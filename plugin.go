@@ -0,0 +1,170 @@
+package fugu
+
+import (
+	"encoding/json"
+	"github.com/mattes/go-collect"
+	"github.com/mattes/go-collect/data"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PluginPrefix is the prefix of plugin executables on PATH,
+// i.e. fugu-seed is run for fugu seed
+const PluginPrefix = "fugu-"
+
+// Plugin env vars, besides FUGU_<KEY> for every key of the label data
+const (
+	// LabelEnv is the label the plugin or hook runs for
+	LabelEnv = "FUGU_CURRENT_LABEL"
+
+	// PluginDataEnv is the path of a temp file with the label data as json
+	PluginDataEnv = "FUGU_DATA_FILE"
+
+	// DataVarsEnv lists the FUGU_<KEY> vars set from the label data,
+	// separated by spaces. The env source of a fugu run by the plugin
+	// or hook skips them, see Environ.
+	DataVarsEnv = "FUGU_DATA_VARS"
+)
+
+// Plugins returns the names of all plugins found on PATH, sorted
+func Plugins() []string {
+	names := make([]string, 0)
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, f := range files {
+			name := strings.TrimPrefix(f.Name(), PluginPrefix)
+			if name == f.Name() || name == "" || f.IsDir() || f.Mode()&0111 == 0 {
+				continue
+			}
+			if !containsString(names, name) && Lookup(name) == nil {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupPlugin returns a command running the plugin name or nil
+// if there is no fugu-name on PATH
+func LookupPlugin(name string) *Command {
+	if name == "" || strings.ContainsRune(name, os.PathSeparator) {
+		return nil
+	}
+	path, err := exec.LookPath(PluginPrefix + name)
+	if err != nil {
+		return nil
+	}
+	return &Command{
+		Name:      name,
+		Synopsis:  "Plugin " + path,
+		Args:      "[LABEL] [ARG...]",
+		FuguFlags: FuguFlags["plugin"],
+		MaxArgs:   -1,
+		RawArgs:   true,
+		Run:       pluginCommand(name, path),
+	}
+}
+
+// pluginCommand returns a RunFunc that resolves the label data and
+// runs the plugin with all args but the label and source options.
+func pluginCommand(name, path string) RunFunc {
+	return func(c *collect.Collector, p *data.Data, args []string) error {
+		// only parse label and sources, the plugin parses the rest
+		fuguArgs, pluginArgs := make([]string, 0), make([]string, 0)
+		for i := 0; i < len(args); i++ {
+			flagName, _, hasValue := splitFlag(args[i])
+			switch {
+			case flagName == "source" && !hasValue && i+1 < len(args):
+				fuguArgs = append(fuguArgs, args[i], args[i+1])
+				i++
+			case flagName == "source":
+				fuguArgs = append(fuguArgs, args[i])
+			case i == 0 && flagName == "":
+				fuguArgs = append(fuguArgs, args[i])
+			default:
+				pluginArgs = append(pluginArgs, args[i])
+			}
+		}
+
+		p, remainingArgs, err := c.Parse(fuguArgs, FuguFlags["plugin"])
+		if err != nil {
+			return err
+		}
+
+		m, err := ParseMultiLabel(c, args)
+		if err != nil {
+			return err
+		}
+		if m != nil {
+			return m.Run(name, os.Stdout, os.Stderr)
+		}
+
+		f, err := ioutil.TempFile("", "fugu-data-")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+		err = json.NewEncoder(f).Encode(p.RawEnhanced())
+		f.Close()
+		if err != nil {
+			return err
+		}
+
+		cmd := exec.Command(path, append(remainingArgs, pluginArgs...)...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		cmd.Env = append(os.Environ(), dataEnv(p)...)
+		cmd.Env = append(cmd.Env, LabelEnv+"="+c.Label(), PluginDataEnv+"="+f.Name())
+
+		if err := runForeground(cmd); err != nil {
+			if code, ok := exitStatus(err); ok {
+				return &ExitError{Code: code}
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+// envReplacer makes keys valid env var names
+var envReplacer = strings.NewReplacer("-", "_", ".", "_")
+
+// dataEnv returns FUGU_<KEY>=value for every key of p, i.e. FUGU_IMAGE,
+// FUGU_DRY_RUN or FUGU_TASKS_FLUSH. Multiple values are separated by newlines.
+func dataEnv(p *data.Data) []string {
+	keys := p.Keys()
+	sort.Strings(keys)
+	env := make([]string, 0, len(keys)+1)
+	names := make([]string, 0, len(keys))
+	for _, k := range keys {
+		name := "FUGU_" + strings.ToUpper(envReplacer.Replace(k))
+		env = append(env, name+"="+strings.Join(p.GetAll(k), "\n"))
+		names = append(names, name)
+	}
+	return append(env, DataVarsEnv+"="+strings.Join(names, " "))
+}
+
+// Environ returns os.Environ without the vars a calling fugu sets for
+// plugins and hooks, so that the env source only reads FUGU_* vars of
+// the user. Register the env source with it.
+func Environ() []string {
+	skip := map[string]bool{LabelEnv: true, PluginDataEnv: true, DataVarsEnv: true}
+	for _, name := range strings.Fields(os.Getenv(DataVarsEnv)) {
+		skip[name] = true
+	}
+
+	env := make([]string, 0)
+	for _, e := range os.Environ() {
+		if !skip[strings.SplitN(e, "=", 2)[0]] {
+			env = append(env, e)
+		}
+	}
+	return env
+}
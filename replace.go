@@ -0,0 +1,73 @@
+package fugu
+
+import (
+	"fmt"
+	"github.com/mattes/go-collect/data"
+	"os"
+	"time"
+)
+
+// DefaultReplaceTimeout is used if replace-timeout is not set
+const DefaultReplaceTimeout = 10
+
+// replaceContainer stops and removes the container named like the one
+// cmd runs and runs cmd afterwards. If the new container fails, the
+// final state of the old one is reported.
+func replaceContainer(p *data.Data, cmd *Cmd) error {
+	name := cmd.Flags.Get("name")
+	if name == "" {
+		return ErrMissingName
+	}
+
+	ins, err := newInspector(p.Get("backend"))
+	if err != nil {
+		return err
+	}
+
+	old, err := ins.inspectContainer(name)
+	if err != nil {
+		return err
+	}
+	if old == nil {
+		return execOrPrint(p, cmd)
+	}
+
+	timeout := p.Get("replace-timeout")
+	if timeout == "" {
+		timeout = fmt.Sprintf("%v", DefaultReplaceTimeout)
+	}
+
+	if old.State.Running {
+		if err := execOrPrint(p, buildDockerCmd("stop", data.New().Set("time", timeout), name)); err != nil {
+			return err
+		}
+
+		if !p.IsTrue("dry-run") {
+			if stopped, err := ins.inspectContainer(name); err == nil && stopped != nil {
+				old = stopped
+			}
+		}
+	}
+
+	if err := execOrPrint(p, buildDockerCmd("rm", data.New(), name)); err != nil {
+		return err
+	}
+
+	if err := execOrPrint(p, cmd); err != nil {
+		fmt.Fprintf(os.Stderr, "replace: old container %v %v\n", name, finalState(old))
+		return err
+	}
+	return nil
+}
+
+// finalState describes the state of a stopped container
+func finalState(c *containerJSON) string {
+	if c.State.Running {
+		return "was running"
+	}
+	s := fmt.Sprintf("exited with status %v", c.State.ExitCode)
+	if !c.State.FinishedAt.IsZero() {
+		s += " at " + c.State.FinishedAt.Format(time.RFC3339)
+	}
+	return s + " and was removed"
+}
@@ -0,0 +1,286 @@
+package fugu
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/docker/docker/pkg/units"
+	"github.com/mattes/go-collect/data"
+	"io"
+	"os/exec"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ContainerStatus describes the container configured by a label
+type ContainerStatus struct {
+	Label     string     `json:"label,omitempty"`
+	Name      string     `json:"name"`
+	Exists    bool       `json:"exists"`
+	State     string     `json:"state"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	Uptime    string     `json:"uptime,omitempty"`
+	ExitCode  int        `json:"exit_code"`
+	ImageID   string     `json:"image_id,omitempty"`
+	Ports     []string   `json:"ports"`
+
+	// Image is the configured image, ImageCurrent is true
+	// if the container runs the image's current ID
+	Image        string `json:"image,omitempty"`
+	ImageCurrent bool   `json:"image_current"`
+}
+
+// containerJSON is the part of docker inspect used by status and diff
+type containerJSON struct {
+	Id    string
+	Name  string
+	Image string
+	State struct {
+		// Status is i.e. created, running or exited, older daemons
+		// don't set it
+		Status     string
+		Running    bool
+		Paused     bool
+		Restarting bool
+		ExitCode   int
+		StartedAt  time.Time
+		FinishedAt time.Time
+		Health     *struct {
+			Status string
+		}
+	}
+	Config          engineConfig
+	HostConfig      engineHostConfig
+	NetworkSettings struct {
+		Ports map[string][]struct {
+			HostIp   string
+			HostPort string
+		}
+	}
+}
+
+// imageJSON is the part of docker inspect used by status and diff
+type imageJSON struct {
+	Id     string
+	Config engineConfig
+}
+
+// inspector looks up containers and images.
+// It returns nil, if they don't exist.
+type inspector interface {
+	inspectContainer(name string) (*containerJSON, error)
+	inspectImage(image string) (*imageJSON, error)
+
+	// containerLogs returns the last tail lines of stdout and stderr
+	containerLogs(name, tail string) (string, error)
+}
+
+// newInspector returns the inspector for the backend, see Exec
+func newInspector(backend string) (inspector, error) {
+	switch backend {
+	case "", "cli":
+		return cliInspector{}, nil
+	case "api":
+		return NewEngine("")
+	default:
+		return nil, ErrUnknownBackend
+	}
+}
+
+// cliInspector runs docker inspect
+type cliInspector struct{}
+
+// inspect runs docker inspect for objects of type kind only, docker
+// would fall back to images with the name of a missing container
+func (cliInspector) inspect(kind, name string, v interface{}) (found bool, err error) {
+	var stdout, stderr bytes.Buffer
+	c := exec.Command("docker", "inspect", "--type="+kind, name)
+	c.Stdout, c.Stderr = &stdout, &stderr
+	if err := c.Run(); err != nil {
+		if strings.Contains(stderr.String(), "No such") {
+			return false, nil
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return false, fmt.Errorf("status: %v", msg)
+		}
+		return false, fmt.Errorf("status: %v", err.Error())
+	}
+
+	var list []json.RawMessage
+	if err := json.Unmarshal(stdout.Bytes(), &list); err != nil {
+		return false, fmt.Errorf("status: %v", err.Error())
+	}
+	if len(list) == 0 {
+		return false, nil
+	}
+	if err := json.Unmarshal(list[0], v); err != nil {
+		return false, fmt.Errorf("status: %v", err.Error())
+	}
+	return true, nil
+}
+
+func (i cliInspector) inspectContainer(name string) (*containerJSON, error) {
+	container := &containerJSON{}
+	found, err := i.inspect("container", name, container)
+	if err != nil || !found {
+		return nil, err
+	}
+	return container, nil
+}
+
+func (i cliInspector) inspectImage(image string) (*imageJSON, error) {
+	img := &imageJSON{}
+	found, err := i.inspect("image", image, img)
+	if err != nil || !found {
+		return nil, err
+	}
+	return img, nil
+}
+
+// inspect gets path from the engine api, a 404 means not found
+func (e *Engine) inspect(path string, v interface{}) (found bool, err error) {
+	req, err := e.newRequest("GET", path, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	if err := e.doJSON(req, v); err != nil {
+		if engineErr, ok := err.(*EngineError); ok && engineErr.StatusCode == 404 {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (e *Engine) inspectContainer(name string) (*containerJSON, error) {
+	container := &containerJSON{}
+	found, err := e.inspect("/containers/"+name+"/json", container)
+	if err != nil || !found {
+		return nil, err
+	}
+	return container, nil
+}
+
+func (e *Engine) inspectImage(image string) (*imageJSON, error) {
+	img := &imageJSON{}
+	found, err := e.inspect("/images/"+image+"/json", img)
+	if err != nil || !found {
+		return nil, err
+	}
+	return img, nil
+}
+
+// containerStatus inspects the container and image configured in p
+func containerStatus(ins inspector, label string, p *data.Data, now time.Time) (*ContainerStatus, error) {
+	s := &ContainerStatus{
+		Label: label,
+		Name:  p.Get("name"),
+		State: "missing",
+		Image: p.Get("image"),
+		Ports: []string{},
+	}
+	if s.Name == "" {
+		s.State = "unnamed"
+		return s, nil
+	}
+
+	container, err := ins.inspectContainer(s.Name)
+	if err != nil {
+		return nil, err
+	}
+	if container == nil {
+		return s, nil
+	}
+
+	s.Exists = true
+	s.ImageID = container.Image
+	s.ExitCode = container.State.ExitCode
+	switch {
+	case container.State.Status != "":
+		s.State = container.State.Status
+	case container.State.Paused:
+		s.State = "paused"
+	case container.State.Restarting:
+		s.State = "restarting"
+	case container.State.Running:
+		s.State = "running"
+	case container.State.StartedAt.IsZero():
+		// never started
+		s.State = "created"
+	default:
+		s.State = "exited"
+	}
+	if container.State.Running && !container.State.StartedAt.IsZero() {
+		startedAt := container.State.StartedAt
+		s.StartedAt = &startedAt
+		s.Uptime = units.HumanDuration(now.Sub(startedAt))
+	}
+
+	for port, bindings := range container.NetworkSettings.Ports {
+		for _, b := range bindings {
+			s.Ports = append(s.Ports, fmt.Sprintf("%v:%v->%v", b.HostIp, b.HostPort, port))
+		}
+	}
+	sort.Strings(s.Ports)
+
+	if s.Image != "" {
+		img, err := ins.inspectImage(s.Image)
+		if err != nil {
+			return nil, err
+		}
+		s.ImageCurrent = img != nil && img.Id == s.ImageID
+	}
+
+	return s, nil
+}
+
+// writeStatus prints statuses as table or json
+func writeStatus(out io.Writer, statuses []*ContainerStatus, asJSON bool) error {
+	if asJSON {
+		buf, err := json.MarshalIndent(statuses, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "%s\n", buf)
+		return err
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "LABEL\tNAME\tSTATE\tUPTIME\tEXIT CODE\tIMAGE ID\tIMAGE CURRENT\tPORTS")
+	for _, s := range statuses {
+		exitCode, imageID, current := "-", "-", "-"
+		if s.Exists {
+			exitCode = fmt.Sprintf("%v", s.ExitCode)
+			imageID = shortID(s.ImageID)
+			if s.Image != "" {
+				current = "no"
+				if s.ImageCurrent {
+					current = "yes"
+				}
+			}
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			orDash(s.Label), orDash(s.Name), s.State, orDash(s.Uptime),
+			exitCode, imageID, current, orDash(strings.Join(s.Ports, ", ")))
+	}
+	return w.Flush()
+}
+
+// shortID truncates docker IDs like docker ps does
+func shortID(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,177 @@
+package fugu
+
+import (
+	"fmt"
+	"github.com/mattes/go-collect"
+	"github.com/mattes/go-collect/data"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// TasksKey is the key of the tasks of a label. The file source
+// flattens nested maps, so task keys look like tasks.migrate.command.
+const TasksKey = "tasks"
+
+// Task is a command defined for a label, like a migration
+type Task struct {
+	Name string
+
+	// Command is the command and its args
+	Command []string
+
+	// Env is added to the environment of Command
+	Env []string
+
+	// Rm runs Command in a new container, removed afterwards,
+	// instead of in the running container of the label
+	Rm bool
+}
+
+// Tasks returns the tasks found in p, sorted by name. A task is either
+// a command like tasks.flush: redis-cli flushall or a map with command,
+// args, env and rm like tasks.migrate.command: rake.
+func Tasks(p *data.Data) ([]*Task, error) {
+	byName := make(map[string]*Task)
+	names := make([]string, 0)
+
+	for _, k := range p.Keys() {
+		if !strings.HasPrefix(k, TasksKey+".") {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(k, TasksKey+"."), ".", 2)
+		name := parts[0]
+
+		t, ok := byName[name]
+		if !ok {
+			t = &Task{Name: name}
+			byName[name] = t
+			names = append(names, name)
+		}
+
+		if len(parts) == 1 {
+			t.Command = splitCommand(p.GetAll(k))
+			continue
+		}
+		switch parts[1] {
+		case "command":
+			t.Command = append(splitCommand(p.GetAll(k)), t.Command...)
+		case "args":
+			t.Command = append(t.Command, p.GetAll(k)...)
+		case "env":
+			t.Env = p.GetAll(k)
+		case "rm":
+			t.Rm = p.IsTrue(k)
+		default:
+			return nil, fmt.Errorf("task %v: unknown key %v", name, parts[1])
+		}
+	}
+
+	sort.Strings(names)
+	tasks := make([]*Task, 0, len(names))
+	for _, name := range names {
+		tasks = append(tasks, byName[name])
+	}
+	return tasks, nil
+}
+
+// splitCommand splits a single command string at whitespace,
+// a list is the command and its args already
+func splitCommand(command []string) []string {
+	if len(command) == 1 {
+		return strings.Fields(command[0])
+	}
+	return command
+}
+
+// cmdTask runs a task of the label or lists all tasks
+func cmdTask(c *collect.Collector, p *data.Data, args []string) error {
+	// tasks don't wait for the wait-for conditions of the label
+	p = data.Merge(p)
+	for _, k := range waitForKeys {
+		p.Delete(k)
+	}
+
+	tasks, err := Tasks(p)
+	if err != nil {
+		return err
+	}
+
+	if p.IsTrue("list") {
+		if len(args) > 0 {
+			return ErrTooManyArgs
+		}
+		return writeTasks(tasks)
+	}
+
+	if len(args) == 0 {
+		return ErrMissingTask
+	}
+
+	var task *Task
+	for _, t := range tasks {
+		if t.Name == args[0] {
+			task = t
+		}
+	}
+	if task == nil {
+		return fmt.Errorf("%v %v", ErrUnknownTask.Error(), args[0])
+	}
+
+	cmd, err := taskCommand(c, p, task, args[1:])
+	if err != nil {
+		return err
+	}
+	return ExecCommand(p, cmd)
+}
+
+// taskCommand returns docker exec for task, or docker run --rm
+func taskCommand(c *collect.Collector, p *data.Data, task *Task, args []string) (*Cmd, error) {
+	command := append(append([]string{}, task.Command...), args...)
+	if len(command) == 0 {
+		return nil, ErrEmptyTask
+	}
+
+	tp := data.New()
+	tp.Merge(p)
+	tp.Delete("command")
+	tp.Delete("arg")
+	tp.Delete("detach")
+
+	if !task.Rm {
+		// docker exec has no --env, use env of the container
+		if len(task.Env) > 0 {
+			command = append(append([]string{"env"}, task.Env...), command...)
+		}
+		return cmdExec(c, tp, command)
+	}
+
+	// the container must neither clash with the running one
+	// nor outlive the task
+	for _, k := range []string{"name", "restart", "publish", "publish-all", "replace"} {
+		tp.Delete(k)
+	}
+	tp.SetTrue("rm")
+	tp.Add("env", task.Env...)
+	return cmdRun(c, tp, command)
+}
+
+// writeTasks prints the tasks as table
+func writeTasks(tasks []*Task) error {
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "TASK\tVIA\tCOMMAND")
+	for _, t := range tasks {
+		via := "exec"
+		if t.Rm {
+			via = "run --rm"
+		}
+		command := t.Command
+		if len(t.Env) > 0 {
+			command = append(append([]string{"env"}, t.Env...), command...)
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\n", t.Name, via, strings.Join(command, " "))
+	}
+	return w.Flush()
+}
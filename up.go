@@ -0,0 +1,107 @@
+package fugu
+
+import (
+	"fmt"
+	"github.com/mattes/go-collect"
+	"github.com/mattes/go-collect/data"
+	"strings"
+)
+
+// up builds the image if path or url is set and (re)creates the
+// container only if it is missing, its config hash or its image changed.
+// It is safe to run repeatedly.
+func up(c *collect.Collector, p *data.Data, args []string) error {
+	name := p.Get("name")
+	if name == "" {
+		return ErrMissingName
+	}
+	if p.Get("image") == "" {
+		return ErrMissingImage
+	}
+
+	ins, err := newInspector(p.Get("backend"))
+	if err != nil {
+		return err
+	}
+
+	if p.Get("path") != "" || p.Get("url") != "" {
+		// build changes p, i.e. the tag
+		cmd, err := cmdBuild(c, data.Merge(p), nil)
+		if err != nil {
+			return err
+		}
+		if err := execOrPrint(p, cmd); err != nil {
+			return err
+		}
+	}
+
+	rp := data.Merge(p)
+	rp.SetTrue("detach")
+	runCmd, err := cmdRun(c, rp, args)
+	if err != nil {
+		return err
+	}
+
+	container, err := ins.inspectContainer(name)
+	if err != nil {
+		return err
+	}
+
+	action := "unchanged"
+	if container == nil {
+		action = "created"
+		if err := execOrPrint(p, runCmd); err != nil {
+			return err
+		}
+
+	} else {
+		reason, err := upReason(ins, container, runCmd)
+		if err != nil {
+			return err
+		}
+
+		if reason != "" {
+			action = "recreated, " + reason
+			if err := execOrPrint(p, buildDockerCmd("rm", data.New().SetTrue("force"), name)); err != nil {
+				return err
+			}
+			if err := execOrPrint(p, runCmd); err != nil {
+				return err
+			}
+
+		} else if !container.State.Running {
+			action = "started"
+			if err := execOrPrint(p, buildDockerCmd("start", data.New(), name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	fmt.Printf("%v: %v\n", name, action)
+	return nil
+}
+
+// upReason returns why the container has to be recreated to match
+// runCmd or an empty string if it is up to date
+func upReason(ins inspector, container *containerJSON, runCmd *Cmd) (string, error) {
+	hash := ""
+	for _, l := range runCmd.Flags.GetAll("label") {
+		if strings.HasPrefix(l, ConfigHashLabel+"=") {
+			hash = strings.TrimPrefix(l, ConfigHashLabel+"=")
+		}
+	}
+	if hash == "" || container.Config.Labels[ConfigHashLabel] != hash {
+		return "config changed", nil
+	}
+
+	img, err := ins.inspectImage(runCmd.Args[0])
+	if err != nil {
+		return "", err
+	}
+	// a missing image is pulled by docker run
+	if img != nil && img.Id != container.Image {
+		return "image changed", nil
+	}
+
+	return "", nil
+}
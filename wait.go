@@ -0,0 +1,331 @@
+package fugu
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/docker/docker/nat"
+	"github.com/mattes/go-collect/data"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultWaitTimeout is used if wait-timeout is not set
+const DefaultWaitTimeout = 60
+
+// waitPollInterval is the time between two readiness checks
+const waitPollInterval = 500 * time.Millisecond
+
+// waitLogLines are printed if a container doesn't get ready
+const waitLogLines = "10"
+
+// waitFor are the wait-for conditions of a label, all must hold
+type waitFor struct {
+	// Port is a container port, i.e. 80/tcp, that must accept connections
+	Port string
+
+	// HTTP is a path that must answer without error on Port
+	HTTP string
+
+	// Log must match the container's logs
+	Log *regexp.Regexp
+
+	// Healthy waits for docker's health status
+	Healthy bool
+}
+
+// newWaitFor returns the wait-for conditions in p or nil if there are none
+func newWaitFor(p *data.Data) (*waitFor, error) {
+	w := &waitFor{
+		HTTP:    p.Get("wait-for-http"),
+		Healthy: p.IsTrue("wait-for-healthy"),
+	}
+
+	if port := p.Get("wait-for-port"); port != "" {
+		proto, port := nat.SplitProtoPort(port)
+		w.Port = string(nat.NewPort(proto, port))
+	}
+
+	// ^ and $ match at line breaks, logs have many lines
+	if expr := p.Get("wait-for-log"); expr != "" {
+		re, err := regexp.Compile("(?m)" + expr)
+		if err != nil {
+			return nil, fmt.Errorf("wait-for-log: %v", err.Error())
+		}
+		w.Log = re
+	}
+
+	if w.Port == "" && w.HTTP == "" && w.Log == nil && !w.Healthy {
+		return nil, nil
+	}
+	return w, nil
+}
+
+// ready checks the conditions once
+func (w *waitFor) ready(ins inspector, container *containerJSON) (bool, error) {
+	if w.Healthy {
+		if ok, err := containerHealthy(container); !ok || err != nil {
+			return ok, err
+		}
+	}
+
+	if w.Port != "" || w.HTTP != "" {
+		port := w.Port
+		if port == "" {
+			// without port, the only published port is used
+			if len(container.NetworkSettings.Ports) != 1 {
+				return false, fmt.Errorf("wait-for-http needs wait-for-port")
+			}
+			for p := range container.NetworkSettings.Ports {
+				port = p
+			}
+		}
+		bindings := container.NetworkSettings.Ports[port]
+		if len(bindings) == 0 {
+			return false, fmt.Errorf("port %v is not published", port)
+		}
+		addr := hostAddr(bindings[0].HostIp, bindings[0].HostPort)
+
+		if w.HTTP != "" {
+			if !httpAnswers("http://" + addr + "/" + strings.TrimPrefix(w.HTTP, "/")) {
+				return false, nil
+			}
+		} else if !portAnswers(addr) {
+			return false, nil
+		}
+	}
+
+	if w.Log != nil {
+		logs, err := ins.containerLogs(strings.TrimPrefix(container.Name, "/"), "all")
+		if err != nil {
+			return false, err
+		}
+		if !w.Log.MatchString(logs) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// containerReady is used without wait-for conditions. It waits until the
+// container is healthy, or if it has no health check, until all its
+// published ports accept connections.
+func containerReady(container *containerJSON) (bool, error) {
+	if container.State.Health != nil {
+		return containerHealthy(container)
+	}
+
+	for _, bindings := range container.NetworkSettings.Ports {
+		for _, b := range bindings {
+			if !portAnswers(hostAddr(b.HostIp, b.HostPort)) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+func containerHealthy(container *containerJSON) (bool, error) {
+	health := container.State.Health
+	if health == nil {
+		return false, fmt.Errorf("container has no health check")
+	}
+	switch health.Status {
+	case "healthy":
+		return true, nil
+	case "unhealthy":
+		return false, fmt.Errorf("container is unhealthy")
+	}
+	return false, nil
+}
+
+// waitReady polls the container until ready returns true. It fails if
+// the container exits, ready fails or the timeout is reached.
+func waitReady(ins inspector, name string, timeout time.Duration, ready func(*containerJSON) (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		container, err := ins.inspectContainer(name)
+		if err != nil {
+			return err
+		}
+		if container == nil {
+			return fmt.Errorf("container %v is gone", name)
+		}
+		if !container.State.Running {
+			return fmt.Errorf("container exited with status %v", container.State.ExitCode)
+		}
+
+		ok, err := ready(container)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("container %v not ready after %v", name, timeout)
+		}
+		time.Sleep(waitPollInterval)
+	}
+}
+
+// waitForKeys are the wait-for conditions, see newWaitFor
+var waitForKeys = []string{"wait-for-port", "wait-for-http", "wait-for-log", "wait-for-healthy"}
+
+// checkWaitRun fails before run starts anything, if there are
+// wait-for conditions, but no detached container to wait for
+func checkWaitRun(p *data.Data, cmd *Cmd) error {
+	w, err := newWaitFor(p)
+	if err != nil || w == nil {
+		return err
+	}
+	if !cmd.Flags.IsTrue("detach") {
+		return ErrWaitNoDetach
+	}
+	if cmd.Flags.Get("name") == "" {
+		return ErrWaitNoName
+	}
+	return nil
+}
+
+// waitRun waits for the wait-for conditions of a detached run
+func waitRun(p *data.Data, cmd *Cmd) error {
+	w, err := newWaitFor(p)
+	if err != nil || w == nil {
+		return err
+	}
+
+	timeout, err := secondsFlag(p, "wait-timeout", DefaultWaitTimeout)
+	if err != nil {
+		return err
+	}
+
+	ins, err := newInspector(p.Get("backend"))
+	if err != nil {
+		return err
+	}
+
+	name := cmd.Flags.Get("name")
+	ready := func(c *containerJSON) (bool, error) {
+		return w.ready(ins, c)
+	}
+	if err := waitReady(ins, name, timeout, ready); err != nil {
+		fmt.Fprintf(os.Stderr, "wait: %v\n", err.Error())
+		printLastLogs(ins, name)
+		return ErrNotReady
+	}
+	return nil
+}
+
+// printLastLogs prints the last log lines of a container to stderr
+func printLastLogs(ins inspector, name string) {
+	logs, err := ins.containerLogs(name, waitLogLines)
+	if err != nil || logs == "" {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "last log lines of %v:\n%v", name, logs)
+	if !strings.HasSuffix(logs, "\n") {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// secondsFlag returns the flag name as duration
+func secondsFlag(p *data.Data, name string, defaultSeconds int) (time.Duration, error) {
+	seconds := defaultSeconds
+	if s := p.Get(name); s != "" {
+		var err error
+		if seconds, err = strconv.Atoi(s); err != nil {
+			return 0, fmt.Errorf("%v: %v", name, err.Error())
+		}
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// hostAddr returns where a published port is reachable
+func hostAddr(ip, port string) string {
+	if ip == "" || ip == "0.0.0.0" {
+		ip = dockerHostIP()
+	}
+	return net.JoinHostPort(ip, port)
+}
+
+// dockerHostIP returns the host of DOCKER_HOST, published ports are found there
+func dockerHostIP() string {
+	if u, err := url.Parse(os.Getenv("DOCKER_HOST")); err == nil && u.Scheme == "tcp" {
+		if host, _, err := net.SplitHostPort(u.Host); err == nil {
+			return host
+		}
+	}
+	return "127.0.0.1"
+}
+
+func portAnswers(addr string) bool {
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+func httpAnswers(u string) bool {
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get(u)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode < 400
+}
+
+// containerLogs returns stdout and stderr of docker logs
+func (cliInspector) containerLogs(name, tail string) (string, error) {
+	var out bytes.Buffer
+	c := exec.Command("docker", "logs", "--tail="+tail, name)
+	c.Stdout, c.Stderr = &out, &out
+	if err := c.Run(); err != nil {
+		return "", fmt.Errorf("logs: %v", strings.TrimSpace(out.String()))
+	}
+	return out.String(), nil
+}
+
+// containerLogs returns stdout and stderr of the container's logs
+func (e *Engine) containerLogs(name, tail string) (string, error) {
+	container, err := e.inspectContainer(name)
+	if err != nil {
+		return "", err
+	}
+	if container == nil {
+		return "", ErrNoContainer
+	}
+
+	query := url.Values{}
+	query.Set("stdout", "1")
+	query.Set("stderr", "1")
+	query.Set("tail", tail)
+	req, err := e.newRequest("GET", "/containers/"+name+"/logs", query, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := e.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var out bytes.Buffer
+	if container.Config.Tty {
+		_, err = out.ReadFrom(resp.Body)
+	} else {
+		err = demuxStream(resp.Body, &out, &out)
+	}
+	return out.String(), err
+}